@@ -0,0 +1,94 @@
+package iam_client
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// AccessKeyExtractor достает ключ доступа из запроса.
+// Если ключа в запросе нет, возвращает пустую строку.
+type AccessKeyExtractor interface {
+	ExtractAccessKey(r *http.Request) string
+}
+
+// AccessKeyFromHeader берет ключ доступа из хедера с именем Name, например, X-Access-Key
+type AccessKeyFromHeader struct {
+	Name string
+}
+
+func (e AccessKeyFromHeader) ExtractAccessKey(r *http.Request) string {
+	return r.Header.Get(e.Name)
+}
+
+// AccessKeyFromAuthorization берет ключ доступа из хедера Authorization вида "<Scheme> <KEY>",
+// например, "Authorization: ApiKey 123". Схема сравнивается без учета регистра.
+type AccessKeyFromAuthorization struct {
+	Scheme string
+}
+
+func (e AccessKeyFromAuthorization) ExtractAccessKey(r *http.Request) string {
+	scheme, key, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, e.Scheme) {
+		return ""
+	}
+
+	return strings.TrimSpace(key)
+}
+
+// AccessKeyFromQuery берет ключ доступа из query-параметра Param. Нужен для вебхуков,
+// которые не умеют передавать хедеры. Значение параметра вырезается из URL, попадающих в лог,
+// и из URL запроса, который middleware передают дальше.
+type AccessKeyFromQuery struct {
+	Param string
+}
+
+func (e AccessKeyFromQuery) ExtractAccessKey(r *http.Request) string {
+	return r.URL.Query().Get(e.Param)
+}
+
+// DefaultAccessKeyExtractors источники ключа доступа по умолчанию - только хедер X-Access-Key
+func DefaultAccessKeyExtractors() []AccessKeyExtractor {
+	return []AccessKeyExtractor{AccessKeyFromHeader{Name: HeaderAccessKey}}
+}
+
+// extractAccessKey перебирает источники ключа в порядке их объявления в конфиге
+// и возвращает первый непустой ключ
+func (s *Service) extractAccessKey(r *http.Request) string {
+	for _, extractor := range s.accessKeyExtractors {
+		if key := extractor.ExtractAccessKey(r); key != "" {
+			return key
+		}
+	}
+
+	return ""
+}
+
+// stripAccessKeys вырезает из query ключи доступа, переданные через AccessKeyFromQuery
+func (s *Service) stripAccessKeys(u *url.URL) *url.URL {
+	if u.RawQuery == "" {
+		return u
+	}
+
+	q := u.Query()
+	stripped := false
+	for _, extractor := range s.accessKeyExtractors {
+		if e, ok := extractor.(AccessKeyFromQuery); ok && q.Has(e.Param) {
+			q.Del(e.Param)
+			stripped = true
+		}
+	}
+	if !stripped {
+		return u
+	}
+
+	clean := *u
+	clean.RawQuery = q.Encode()
+
+	return &clean
+}
+
+// safeURL возвращает URL запроса, пригодный для записи в лог
+func (s *Service) safeURL(r *http.Request) string {
+	return s.stripAccessKeys(r.URL).String()
+}
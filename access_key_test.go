@@ -0,0 +1,115 @@
+package iam_client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestService_extractAccessKey(t *testing.T) {
+	extractors := []AccessKeyExtractor{
+		AccessKeyFromHeader{Name: HeaderAccessKey},
+		AccessKeyFromAuthorization{Scheme: "ApiKey"},
+		AccessKeyFromQuery{Param: "access_key"},
+	}
+
+	tests := []struct {
+		name    string
+		rawURL  string
+		headers map[string]string
+		want    string
+	}{
+		{
+			name:   "No key",
+			rawURL: "/api/v1/hook",
+			want:   "",
+		},
+
+		{
+			name:    "Header has the highest priority",
+			rawURL:  "/api/v1/hook?access_key=query",
+			headers: map[string]string{HeaderAccessKey: "header", "Authorization": "ApiKey auth"},
+			want:    "header",
+		},
+
+		{
+			name:    "Authorization header",
+			rawURL:  "/api/v1/hook?access_key=query",
+			headers: map[string]string{"Authorization": "apikey auth"},
+			want:    "auth",
+		},
+
+		{
+			name:    "Authorization header with another scheme",
+			rawURL:  "/api/v1/hook",
+			headers: map[string]string{"Authorization": "Bearer token"},
+			want:    "",
+		},
+
+		{
+			name:   "Query param",
+			rawURL: "/api/v1/hook?access_key=query",
+			want:   "query",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{accessKeyExtractors: extractors}
+			u, _ := url.Parse(tt.rawURL)
+			r := &http.Request{URL: u, Header: http.Header{}}
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+
+			if got := s.extractAccessKey(r); got != tt.want {
+				t.Errorf("extractAccessKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_safeURL(t *testing.T) {
+	s := &Service{accessKeyExtractors: []AccessKeyExtractor{AccessKeyFromQuery{Param: "access_key"}}}
+	u, _ := url.Parse("/api/v1/hook?access_key=secret&id=1")
+
+	if got := s.safeURL(&http.Request{URL: u}); got != "/api/v1/hook?id=1" {
+		t.Errorf("safeURL() = %v, want %v", got, "/api/v1/hook?id=1")
+	}
+}
+
+func TestService_stripAccessKeyBeforeNext(t *testing.T) {
+	iam := newTestIam(t)
+	s := New("some_service", Config{
+		IamUrl:              iam.URL,
+		AccessKeyExtractors: []AccessKeyExtractor{AccessKeyFromQuery{Param: "access_key"}},
+	}, nopLogger{})
+
+	const wantURI = "/api/v1/hook?id=1"
+	var gotURI, gotRequestURI string
+	handler := s.AccessKeyOnlyMiddleware(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		gotURI, gotRequestURI = r.URL.RequestURI(), r.RequestURI
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/hook?access_key=valid&id=1", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	if gotURI != wantURI || gotRequestURI != wantURI {
+		t.Errorf("next handler got %q (RequestURI %q), want %q", gotURI, gotRequestURI, wantURI)
+	}
+	if r.URL.RawQuery != "access_key=valid&id=1" {
+		t.Errorf("original request URL changed to %q", r.URL.String())
+	}
+
+	gotURI = ""
+	e := echo.New()
+	e.GET("/api/v1/hook", func(c echo.Context) error {
+		gotURI = c.Request().URL.RequestURI()
+		return nil
+	}, s.EchoAuthMiddlewareHandler())
+	r = httptest.NewRequest(http.MethodGet, "/api/v1/hook?access_key=valid&id=1", nil)
+	e.ServeHTTP(httptest.NewRecorder(), r)
+	if gotURI != wantURI {
+		t.Errorf("echo handler got %q, want %q", gotURI, wantURI)
+	}
+}
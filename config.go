@@ -3,4 +3,9 @@ package iam_client
 type Config struct {
 	// URL сервиса IAM
 	IamUrl string `env:"IAM_URL,required"`
+
+	// AccessKeyExtractors источники ключа доступа (app2app) в порядке приоритета:
+	// используется первый найденный непустой ключ. Если не задано, ключ берется
+	// только из хедера X-Access-Key, см. DefaultAccessKeyExtractors
+	AccessKeyExtractors []AccessKeyExtractor `env:"-"`
 }
@@ -0,0 +1,102 @@
+package iam_client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Principal аутентифицированный пользователь или приложение
+type Principal struct {
+	// UserId email пользователя или id приложения
+	UserId string
+
+	// Permissions права на сервис, полученные от IAM
+	Permissions []string
+
+	// SuperPermission право глобального правила без ограничения по методам (например, "admin:*"),
+	// по которому PermissionsChecker пустил к ручке. Дает любое право, см. HasPermission
+	SuperPermission string
+}
+
+// GetPrincipal собирает Principal из контекста запроса
+func GetPrincipal(ctx context.Context) Principal {
+	return Principal{
+		UserId:          GetUserId(ctx),
+		Permissions:     GetPermissions(ctx),
+		SuperPermission: GetSuperPermission(ctx),
+	}
+}
+
+// EchoContextKeys ключи, под которыми echo-middleware кладут данные пользователя в echo.Context
+type EchoContextKeys struct {
+	// Principal ключ для Principal
+	Principal string
+
+	// Permissions ключ для []string прав пользователя
+	Permissions string
+
+	// UserId ключ для id пользователя
+	UserId string
+}
+
+// DefaultEchoContextKeys ключи echo.Context по умолчанию
+var DefaultEchoContextKeys = EchoContextKeys{
+	Principal:   "iam.principal",
+	Permissions: "iam.permissions",
+	UserId:      "iam.user_id",
+}
+
+// GetPrincipal возвращает Principal из echo.Context. Если middleware его не положила, возвращает false
+func (k EchoContextKeys) GetPrincipal(c echo.Context) (Principal, bool) {
+	principal, ok := c.Get(k.Principal).(Principal)
+	return principal, ok
+}
+
+// GetPermissions возвращает права пользователя из echo.Context
+func (k EchoContextKeys) GetPermissions(c echo.Context) []string {
+	permissions, _ := c.Get(k.Permissions).([]string)
+	return permissions
+}
+
+// GetUserId возвращает id пользователя из echo.Context
+func (k EchoContextKeys) GetUserId(c echo.Context) string {
+	userId, _ := c.Get(k.UserId).(string)
+	return userId
+}
+
+// set кладет в echo.Context данные пользователя из контекста запроса r
+func (k EchoContextKeys) set(c echo.Context, r *http.Request) {
+	principal := GetPrincipal(r.Context())
+	c.Set(k.Principal, principal)
+	c.Set(k.Permissions, principal.Permissions)
+	c.Set(k.UserId, principal.UserId)
+}
+
+// EchoGetPrincipal возвращает Principal из echo.Context по ключу по умолчанию
+func EchoGetPrincipal(c echo.Context) (Principal, bool) {
+	return DefaultEchoContextKeys.GetPrincipal(c)
+}
+
+// EchoGetPermissions возвращает права пользователя из echo.Context по ключу по умолчанию
+func EchoGetPermissions(c echo.Context) []string {
+	return DefaultEchoContextKeys.GetPermissions(c)
+}
+
+// EchoGetUserId возвращает id пользователя из echo.Context по ключу по умолчанию
+func EchoGetUserId(c echo.Context) string {
+	return DefaultEchoContextKeys.GetUserId(c)
+}
+
+// WithEchoContextKeys задает ключи, под которыми echo-middleware сервиса кладут данные пользователя в echo.Context.
+// По умолчанию используются DefaultEchoContextKeys.
+func (s *Service) WithEchoContextKeys(keys EchoContextKeys) {
+	s.echoContextKeys = keys
+}
+
+// WithEchoContextKeys задает ключи, под которыми EchoAuthMiddlewareHandler кладет данные пользователя в echo.Context.
+// По умолчанию используются DefaultEchoContextKeys.
+func (p *PermissionsChecker) WithEchoContextKeys(keys EchoContextKeys) {
+	p.echoContextKeys = keys
+}
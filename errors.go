@@ -0,0 +1,243 @@
+package iam_client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// AuthErrorReason типизированная причина отказа в доступе
+type AuthErrorReason string
+
+const (
+	// ReasonAccessKeyMissing в запросе нет ключа доступа
+	ReasonAccessKeyMissing AuthErrorReason = "access_key_missing"
+	// ReasonAccessKeyRejected IAM отверг ключ доступа, статус IAM передается как есть
+	ReasonAccessKeyRejected AuthErrorReason = "access_key_rejected"
+	// ReasonEmptyReferer в запросе нет реферера, некуда возвращать пользователя после аутентификации
+	ReasonEmptyReferer AuthErrorReason = "empty_referer"
+	// ReasonUnauthenticated пользователя нужно отправить на аутентификацию по RedirectURL
+	ReasonUnauthenticated AuthErrorReason = "unauthenticated"
+	// ReasonTokenRejected IAM отверг токен пользователя, статус IAM передается как есть
+	ReasonTokenRejected AuthErrorReason = "token_rejected"
+	// ReasonIamUnavailable не удалось получить ответ от IAM
+	ReasonIamUnavailable AuthErrorReason = "iam_unavailable"
+	// ReasonInternal внутренняя ошибка обработки запроса
+	ReasonInternal AuthErrorReason = "internal"
+	// ReasonEmptyPermissions у пользователя нет ни одного права на сервис
+	ReasonEmptyPermissions AuthErrorReason = "empty_permissions"
+	// ReasonForbidden у пользователя нет прав на ручку
+	ReasonForbidden AuthErrorReason = "forbidden"
+)
+
+// AuthError ошибка аутентификации или авторизации, которую middleware отдает клиенту
+type AuthError struct {
+	// Status HTTP статус ответа
+	Status int
+
+	// Reason причина отказа
+	Reason AuthErrorReason
+
+	// RedirectURL ссылка на аутентификацию в Keycloak, заполняется для 401
+	RedirectURL string
+
+	// Message текст ответа
+	Message string
+
+	// Err исходная ошибка, клиенту не отдается
+	Err error
+
+	// Key ключ матрицы доступа ручки, заполняется для 403 при WithForbiddenDetails
+	Key string
+
+	// Required права правила матрицы, любое из которых (с учетом выражений) выполняет правило,
+	// заполняется для 403 при WithForbiddenDetails
+	Required []string
+
+	// RouteRequired права, заданные на ручке через Require: любое из них нужно в дополнение к Required,
+	// заполняется для 403 при WithForbiddenDetails
+	RouteRequired []string
+
+	// Missing права, которых не хватило пользователю, заполняется для 403 при WithForbiddenDetails
+	Missing []string
+
+	// RequestId id запроса из заголовка RequestIdHeader, заполняется для 403
+	RequestId string
+}
+
+// AuthErrorBody публичная часть AuthError, которую можно отдать клиенту
+type AuthErrorBody struct {
+	Reason        AuthErrorReason `json:"reason"`
+	RedirectURL   string          `json:"redirect_url,omitempty"`
+	Message       string          `json:"message,omitempty"`
+	Route         string          `json:"route,omitempty"`
+	Required      []string        `json:"required_permissions,omitempty"`
+	RouteRequired []string        `json:"route_required_permissions,omitempty"`
+	Missing       []string        `json:"missing_permissions,omitempty"`
+	RequestId     string          `json:"request_id,omitempty"`
+}
+
+// Body возвращает то, что можно отдать клиенту в теле ответа
+func (e *AuthError) Body() AuthErrorBody {
+	return AuthErrorBody{
+		Reason:        e.Reason,
+		RedirectURL:   e.RedirectURL,
+		Message:       e.Message,
+		Route:         e.Key,
+		Required:      e.Required,
+		RouteRequired: e.RouteRequired,
+		Missing:       e.Missing,
+		RequestId:     e.RequestId,
+	}
+}
+
+// echoHTTPError заворачивает ошибку в *echo.HTTPError. Сообщением выступает AuthErrorBody,
+// исходный *AuthError достается через errors.As
+func (e *AuthError) echoHTTPError() *echo.HTTPError {
+	return echo.NewHTTPError(e.Status, e.Body()).SetInternal(e)
+}
+
+func (e *AuthError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%d %s: %s", e.Status, e.Reason, e.Err)
+	}
+
+	return fmt.Sprintf("%d %s", e.Status, e.Reason)
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorResponder отрисовывает ответ на ошибку аутентификации или авторизации
+type ErrorResponder func(w http.ResponseWriter, r *http.Request, authErr *AuthError)
+
+// DefaultErrorResponder отдает 401 с JSON вида {"redirect_url": "..."}, если есть ссылка на аутентификацию,
+// в остальных случаях - только статус и текст ошибки, если он есть
+func DefaultErrorResponder(w http.ResponseWriter, _ *http.Request, authErr *AuthError) {
+	if authErr.RedirectURL != "" {
+		data, _ := json.Marshal(link401{RedirectURL: authErr.RedirectURL})
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(authErr.Status)
+		_, _ = w.Write(data)
+		return
+	}
+
+	w.WriteHeader(authErr.Status)
+	if authErr.Message != "" {
+		_, _ = w.Write([]byte(authErr.Message))
+	}
+}
+
+// JSONErrorResponder отдает ошибку в виде JSON AuthErrorBody, например,
+// {"reason": "forbidden", "message": "Forbidden", "route": "DELETE/api/v1/category/{id}", "request_id": "..."}
+func JSONErrorResponder(w http.ResponseWriter, _ *http.Request, authErr *AuthError) {
+	data, _ := json.Marshal(authErr.Body())
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(authErr.Status)
+	_, _ = w.Write(data)
+}
+
+// WithErrorResponder задает функцию, которой middleware сервиса отрисовывают ошибки.
+// Она же кладется в контекст запроса, и ей отдает 403 PermissionsChecker без своего ErrorResponder
+func (s *Service) WithErrorResponder(responder ErrorResponder) {
+	s.errorResponder = responder
+	s.errorResponderSet = true
+}
+
+// ctxErrorResponder ключ контекста для ErrorResponder сервиса
+type ctxErrorResponder struct{}
+
+// withErrorResponder кладет в контекст ErrorResponder, заданный через WithErrorResponder.
+// Ответы по умолчанию не передаются, чтобы PermissionsChecker без настроек отдавал прежний пустой 403
+func (s *Service) withErrorResponder(ctx context.Context) context.Context {
+	if !s.errorResponderSet {
+		return ctx
+	}
+
+	return context.WithValue(ctx, ctxErrorResponder{}, s.errorResponder)
+}
+
+// WithEchoHTTPErrors включает режим, в котором echo-middleware сервиса не пишут ответ сами, а возвращают
+// *echo.HTTPError с AuthError внутри. Отрисовка ошибки в этом случае остается за HTTPErrorHandler приложения.
+func (s *Service) WithEchoHTTPErrors(enabled bool) {
+	s.echoHTTPErrors = enabled
+}
+
+func (s *Service) respondError(w http.ResponseWriter, r *http.Request, authErr *AuthError) {
+	s.errorResponder(w, r, authErr)
+}
+
+// echoRespondError отдает ошибку в echo: либо возвращает *echo.HTTPError, либо отрисовывает ее ErrorResponder-ом
+func (s *Service) echoRespondError(c echo.Context, authErr *AuthError) error {
+	if s.echoHTTPErrors {
+		return authErr.echoHTTPError()
+	}
+
+	s.respondError(c.Response(), c.Request(), authErr)
+
+	return nil
+}
+
+// RequestIdHeader заголовок с id запроса, который PermissionsChecker отдает в теле 403.
+// Ищется сначала в ответе (его туда кладут, например, middleware.RequestID из echo), потом в запросе
+const RequestIdHeader = "X-Request-Id"
+
+// WithErrorResponder задает функцию, которой middleware проверки прав отрисовывают 403, например,
+// JSONErrorResponder. Без нее используется ErrorResponder из Service.WithErrorResponder, если запрос
+// прошел через middleware сервиса, а если и он не задан - net/http middleware отдают 403 без тела,
+// а echo - текст "Forbidden".
+func (p *PermissionsChecker) WithErrorResponder(responder ErrorResponder) {
+	p.errorResponder = responder
+}
+
+// responder возвращает ErrorResponder для 403: свой, сервиса из контекста запроса или nil
+func (p *PermissionsChecker) responder(r *http.Request) ErrorResponder {
+	if p.errorResponder != nil {
+		return p.errorResponder
+	}
+	responder, _ := r.Context().Value(ctxErrorResponder{}).(ErrorResponder)
+
+	return responder
+}
+
+// WithForbiddenDetails включает в 403 ключ матрицы ручки и права: разрешенные и недостающие.
+// Так фронтенд может подсказать пользователю, какой доступ запросить. Детали раскрывают матрицу доступа
+// клиенту, поэтому в проде их стоит выключать; id запроса и причина отдаются всегда.
+func (p *PermissionsChecker) WithForbiddenDetails(enabled bool) {
+	p.forbiddenDetails = enabled
+}
+
+// forbidden отдает 403 ErrorResponder-ом (см. responder) или пустой 403, если он не задан
+func (p *PermissionsChecker) forbidden(w http.ResponseWriter, r *http.Request, decision Decision) {
+	responder := p.responder(r)
+	if responder == nil {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	responder(w, r, p.forbiddenError(w, r, decision))
+}
+
+// forbiddenError собирает AuthError для отказа decision
+func (p *PermissionsChecker) forbiddenError(w http.ResponseWriter, r *http.Request, decision Decision) *AuthError {
+	authErr := &AuthError{
+		Status:    http.StatusForbidden,
+		Reason:    decision.Reason,
+		Message:   "Forbidden",
+		RequestId: w.Header().Get(RequestIdHeader),
+	}
+	if authErr.RequestId == "" {
+		authErr.RequestId = r.Header.Get(RequestIdHeader)
+	}
+	if p.forbiddenDetails {
+		authErr.Key, authErr.Missing = decision.Key, decision.Missing
+		authErr.Required = append([]string(nil), decision.Required...)
+		authErr.RouteRequired = append([]string(nil), decision.RouteRequired...)
+	}
+
+	return authErr
+}
@@ -53,6 +53,12 @@ func gorillaMuxRouter(r *mux.Router) {
 	// Вызов WithGorillaMuxRouter нужен, чтобы заработали пути роутера с макросами
 	iamPermissionsChecker.WithGorillaMuxRouter(r)
 
+	// Сверяем ручки роутера с матрицей: POST-ручка категории без правила попадет в отчет и лог.
+	// С strict=true при расхождениях вернется ошибка, и сервис можно не запускать
+	if _, err := iamPermissionsChecker.Validate(r, false); err != nil {
+		panic(err)
+	}
+
 	r.Use(
 		// Аутентификация пользователя (по ключу ИЛИ по кукам)
 		iamClient.AuthMiddlewareHandler,
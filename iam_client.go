@@ -7,6 +7,8 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+
+	"github.com/pkg/errors"
 )
 
 func NewIamClient(serviceId, iamURL string, logger Logger, httpClient *http.Client) *IamClient {
@@ -246,3 +248,107 @@ func (c *IamClient) IsTokenValid(tokenId string) (resp IAMResponseSuccess, err e
 
 	return
 }
+
+// GetRoutePolicy обращается на ручку IAM /api/v2/getRoutePolicy за матрицей доступа сервиса.
+// etag - версия уже полученной матрицы или "": если матрица не изменилась, IAM отвечает 304
+// и возвращается resp.NotModified. Тело ответа имеет формат файла матрицы доступа, см. ParsePermissionsMatrix.
+func (c *IamClient) GetRoutePolicy(etag string) (resp IAMGetRoutePolicyResponse, err error) {
+	uri := fmt.Sprintf("%s/api/v2/getRoutePolicy?service_id=%s", c.iamURL, url.QueryEscape(c.serviceId))
+	req, err := http.NewRequest(http.MethodGet, uri, nil)
+	if err != nil {
+		c.log.Errorf("KpOCevAQ5Z7uhQs %s", err)
+		return resp, errors.Wrap(err, "route policy request")
+	}
+	req.Header.Set("X-Client-Id", c.serviceId)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	httpResp, err := c.httpClient.Do(req)
+	if err != nil {
+		c.log.Errorf("jzFzG6dDPfLJeXm %s", err)
+		return resp, errors.Wrap(err, "route policy request")
+	}
+	defer httpResp.Body.Close()
+
+	resp.HttpStatus = httpResp.StatusCode
+	resp.ETag = httpResp.Header.Get("ETag")
+
+	switch httpResp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		resp.NotModified = true
+		if resp.ETag == "" {
+			resp.ETag = etag
+		}
+		return resp, nil
+	default:
+		c.log.Errorf("D4KLSS1dhHghp6d non-200 status from %s: %d", uri, httpResp.StatusCode)
+		return resp, errors.Errorf("non-200 status from %s: %d", uri, httpResp.StatusCode)
+	}
+
+	body, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		c.log.Errorf("QZvrNjjj5y8dujm %s", err)
+		return resp, errors.Wrap(err, "read route policy")
+	}
+
+	resp.PermissionsMatrix, err = ParsePermissionsMatrix(body)
+	if err != nil {
+		c.log.Errorf("snaWNtUYlyYqDvM invalid route policy from IAM: %s", err)
+		return resp, errors.Wrap(err, "route policy from IAM")
+	}
+
+	return resp, nil
+}
+
+// UpsertPermissions обращается на ручку IAM /api/v2/upsertPermissions и заменяет каталог прав сервиса
+func (c *IamClient) UpsertPermissions(permissions []IAMPermission) error {
+	request, err := json.Marshal(IAMUpsertPermissionsRequest{
+		ServiceId:   c.serviceId,
+		Permissions: permissions,
+	})
+	if err != nil {
+		c.log.Errorf("EgaTqoYNpGC9zQu %s", err)
+		return errors.Wrap(err, "permissions catalog")
+	}
+
+	uri := fmt.Sprintf("%s/api/v2/upsertPermissions", c.iamURL)
+	req, err := http.NewRequest(http.MethodPost, uri, bytes.NewBuffer(request))
+	if err != nil {
+		c.log.Errorf("T4XfbeDFcJNWwqx %s", err)
+		return errors.Wrap(err, "permissions catalog request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Client-Id", c.serviceId)
+
+	httpResp, err := c.httpClient.Do(req)
+	if err != nil {
+		c.log.Errorf("lHMUfB8nwRecDOS %s", err)
+		return errors.Wrap(err, "permissions catalog request")
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		c.log.Errorf("zfQdKmR1c2D3j3d non-200 status from %s: %d", uri, httpResp.StatusCode)
+		return errors.Errorf("non-200 status from %s: %d", uri, httpResp.StatusCode)
+	}
+
+	body, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		c.log.Errorf("WIOW67mvph4URjT %s", err)
+		return errors.Wrap(err, "read permissions catalog response")
+	}
+
+	var resp IAMResponseSuccess
+	if err := json.Unmarshal(body, &resp); err != nil {
+		c.log.Errorf("AFt2bOZHGRVYnRW %s", err)
+		return errors.Wrap(err, "permissions catalog response")
+	}
+	if !resp.Success {
+		c.log.Errorf("4L7DKCjKZ3k1ITk IAM rejected the permissions catalog of %s", c.serviceId)
+		return errors.New("IAM rejected the permissions catalog")
+	}
+
+	return nil
+}
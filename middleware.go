@@ -13,159 +13,133 @@ const (
 	HeaderAccessKey = "X-Access-Key"
 )
 
-// AuthAccessKey аутентифицирует приложение по хедеру X-Access-Key
-// Если хедер присутствуют, полностью берет обработку на себя, в этом случае возвращает true
+// AuthAccessKey аутентифицирует приложение по ключу доступа (по умолчанию - хедер X-Access-Key,
+// источники ключа настраиваются в Config.AccessKeyExtractors)
+// Если ключ присутствует, полностью берет обработку на себя, в этом случае возвращает true
 func (s *Service) AuthAccessKey(w http.ResponseWriter, r *http.Request, next http.Handler) (processed bool) {
-	// Проверяем наличие хедеров X-Access-Key
-	accessKey := r.Header.Get(HeaderAccessKey)
+	// Проверяем наличие ключа доступа
+	accessKey := s.extractAccessKey(r)
 	if accessKey == "" {
 		return
 	}
 
-	// Ключ в хедере есть, полностью берем обработку запроса на себя
+	// Ключ есть, полностью берем обработку запроса на себя
 	processed = true
 
-	// Запрашиваем у IAM пермишены
-	resp, err := s.iamClient.GetAccessKeyPermissions(accessKey, s.serviceId)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
-	// Все хорошо, кладем права в контекст и идем дальше
-	if resp.HttpStatus == http.StatusOK {
-		r = r.WithContext(context.WithValue(r.Context(), CtxIamPermissions{}, resp.Permissions))
-
-		r = r.WithContext(context.WithValue(r.Context(), CtxIamUserId{}, resp.UserId))
-
-		next.ServeHTTP(w, r)
+	r, authErr := s.checkAccessKey(r, accessKey)
+	if authErr != nil {
+		s.respondError(w, r, authErr)
 		return
 	}
 
-	// Получен не 200, отдаем статус как есть
-	w.WriteHeader(resp.HttpStatus)
+	next.ServeHTTP(w, r)
 
 	return
 }
 
 // AuthAccessKeyMiddleware миддлварь для проверки доступа только по ключу
+//
+// Deprecated: используйте AccessKeyOnlyMiddleware или EchoAccessKeyOnlyMiddleware
 func (s *Service) AuthAccessKeyMiddleware(_ http.ResponseWriter, r *http.Request) (*http.Request, error) {
-	accessKey := r.Header.Get(HeaderAccessKey)
+	accessKey := s.extractAccessKey(r)
 	if accessKey == "" {
-		return r, errors.New("X-Access-Key is missing")
+		return r, errors.New("access key is missing")
 	}
 
-	// Запрашиваем у IAM пермишены
-	resp, err := s.iamClient.GetAccessKeyPermissions(accessKey, s.serviceId)
-	if err != nil {
-		return r, err
-	}
-
-	// Получен не 200, отдаем статус как есть
-	if resp.HttpStatus != http.StatusOK {
-		return r, errors.Errorf("unauthorized: %d", resp.HttpStatus)
+	r, authErr := s.checkAccessKey(r, accessKey)
+	if authErr != nil {
+		if authErr.Err != nil {
+			return r, authErr.Err
+		}
+		return r, errors.Errorf("unauthorized: %d", authErr.Status)
 	}
 
-	// Все хорошо, кладем права в контекст и идем дальше
-	r = r.WithContext(context.WithValue(r.Context(), CtxIamPermissions{}, resp.Permissions))
-
-	r = r.WithContext(context.WithValue(r.Context(), CtxIamUserId{}, resp.UserId))
-
 	return r, nil
 }
 
-// AuthMiddlewareHandler выполняет аутентификацию пользователя (по ключу ИЛИ по кукам)
-func (s *Service) AuthMiddlewareHandler(next http.Handler) http.Handler {
+// AccessKeyOnlyMiddleware пускает только приложения с ключом доступа (app2app), куки не проверяются.
+// Если ключа нет, отдает 401, если IAM отверг ключ - статус IAM как есть (например, 403).
+// Ошибки отрисовываются через ErrorResponder сервиса.
+func (s *Service) AccessKeyOnlyMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Шаг 1. Аутентификация приложения по ключу доступа (app2app)
-		// Схема аутентификации app2app отличается от user2app в основном тем,
-		// что в ней нет редиректа в IAM за аутентификацией
-		if s.AuthAccessKey(w, r, next) {
+		if s.publicRoutes.Match(r) {
+			next.ServeHTTP(w, r)
 			return
 		}
 
-		// Шаг 2. Аутентификация пользователя (user2app)
-		// Если это запрос после аутентификации в IAM, обрабатываем его
-		q := r.URL.Query()
-		code := q.Get("code")
-		finalBackURL := q.Get("finalBackURL")
-		if code != "" && finalBackURL != "" {
-			s.setTokenIdHandler().ServeHTTP(w, r)
+		accessKey := s.extractAccessKey(r)
+		if accessKey == "" {
+			s.respondError(w, r, &AuthError{Status: http.StatusUnauthorized, Reason: ReasonAccessKeyMissing})
 			return
 		}
 
-		// URL, на который IAM вернет пользователя после успешной аутентифицикации
-		backURL, err := s.getBackURL(r)
-		if err != nil {
-			if errors.Is(err, ErrEmptyReferer) {
-				w.WriteHeader(http.StatusBadRequest)
-				_, _ = w.Write([]byte(ErrEmptyReferer.Error()))
-				return
-			}
-
-			s.log.Errorf("s4F9pAY2DugXZd0 %s", err)
-			w.WriteHeader(http.StatusInternalServerError)
+		r, authErr := s.checkAccessKey(r, accessKey)
+		if authErr != nil {
+			s.respondError(w, r, authErr)
 			return
 		}
 
-		// Проверяем id токена в куках
-		tokenIdCk, err := r.Cookie(CookieName_TokenId)
-		if err != nil {
-			// Куки нет, дергаем ручку IAM getAuthLink и отдаем 401 со ссылкой в ответе
-			authLinkResponse, err := s.iamClient.GetAuthLink(backURL)
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				return
-			}
+		next.ServeHTTP(w, r)
+	})
+}
 
-			s.returnRedirectJSON(w, authLinkResponse.RedirectUrl)
-			return
+// checkAccessKey запрашивает у IAM права по ключу доступа и, если все хорошо, кладет их в контекст запроса
+func (s *Service) checkAccessKey(r *http.Request, accessKey string) (*http.Request, *AuthError) {
+	// Запрашиваем у IAM пермишены
+	resp, err := s.iamClient.GetAccessKeyPermissions(accessKey, s.serviceId)
+	if err != nil {
+		return r, &AuthError{Status: http.StatusInternalServerError, Reason: ReasonIamUnavailable, Err: err}
+	}
+
+	// Получен не 200, отдаем статус как есть
+	if resp.HttpStatus != http.StatusOK {
+		s.log.Warningf("oXYs2EWA78Q2rvB access key rejected by IAM for %s: %d", s.safeURL(r), resp.HttpStatus)
+		return r, &AuthError{Status: resp.HttpStatus, Reason: ReasonAccessKeyRejected}
+	}
+
+	// Все хорошо, кладем права и id в контекст (одной копией запроса) и идем дальше
+	ctx := context.WithValue(s.withErrorResponder(r.Context()), CtxIamPermissions{}, resp.Permissions)
+	r = r.WithContext(context.WithValue(ctx, CtxIamUserId{}, resp.UserId))
+
+	// Ключ из query не должен дойти до следующих обработчиков, их логов и трейсинга.
+	// stripAccessKeys возвращает копию URL, исходный запрос не меняется
+	if clean := s.stripAccessKeys(r.URL); clean != r.URL {
+		r.URL = clean
+		if r.RequestURI != "" {
+			r.RequestURI = clean.RequestURI()
 		}
+	}
 
-		// Кука есть - запрашиваем у IAM пермишены по ручке getTokenPermissions
-		tokenId, err := url.QueryUnescape(tokenIdCk.Value)
-		if err != nil {
-			s.log.Errorf("91sfK8v3s0QB5k9 %s", err)
-			w.WriteHeader(http.StatusInternalServerError)
+	return r, nil
+}
+
+// AuthMiddlewareHandler выполняет аутентификацию пользователя (по ключу ИЛИ по кукам).
+// Публичные ручки (см. WithPublicRoutes) пропускаются без аутентификации, это верно для всех middleware сервиса.
+func (s *Service) AuthMiddlewareHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.publicRoutes.Match(r) {
+			next.ServeHTTP(w, r)
 			return
 		}
 
-		resp, err := s.iamClient.GetTokenPermissions(tokenId, s.serviceId, backURL)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+		// Шаг 1. Аутентификация приложения по ключу доступа (app2app)
+		// Схема аутентификации app2app отличается от user2app в основном тем,
+		// что в ней нет редиректа в IAM за аутентификацией
+		if s.AuthAccessKey(w, r, next) {
 			return
 		}
 
-		// Отправляем юзера на аутентификацию в IAM
-		if resp.HttpStatus == http.StatusUnauthorized {
-			s.returnRedirectJSON(w, resp.RedirectUrl)
+		// Шаг 2. Аутентификация пользователя (user2app)
+		r, processed, authErr := s.authToken(w, r, false)
+		if processed {
 			return
 		}
-
-		// Все хорошо, кладем права в контекст и идем дальше
-		if resp.HttpStatus == http.StatusOK {
-			r = r.WithContext(context.WithValue(r.Context(), CtxIamPermissions{}, resp.Permissions))
-
-			// Добавляем содержимое куки CookieName_UserEmail как userId
-			var userEmail string
-			userEmailCk, err := r.Cookie(CookieName_UserEmail)
-			if err != nil {
-				// Такого быть не должно ругнемся в лог
-				s.log.Errorf("No cookie %s", CookieName_UserEmail)
-			} else {
-				userEmail, err = url.QueryUnescape(userEmailCk.Value)
-				if err != nil {
-					s.log.Errorf("6k5X83JDf2cI11V %s", err)
-				}
-			}
-			r = r.WithContext(context.WithValue(r.Context(), CtxIamUserId{}, userEmail))
-
-			next.ServeHTTP(w, r)
+		if authErr != nil {
+			s.respondError(w, r, authErr)
 			return
 		}
 
-		// Получен не 200 и не 401, отдаем статус как есть
-		w.WriteHeader(resp.HttpStatus)
+		next.ServeHTTP(w, r)
 	})
 }
 
@@ -177,67 +151,115 @@ func (s *Service) AuthMiddlewareHandler(next http.Handler) http.Handler {
 // Эта middleware не выставляет статус 403. Возможны только 200, 401 и 503.
 func (s *Service) SimpleAuthMiddlewareHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Авторизация пользователя (user2app)
-		// Если это запрос после аутентификации в IAM, обрабатываем его
-		q := r.URL.Query()
-		code := q.Get("code")
-		finalBackURL := q.Get("finalBackURL")
-		if code != "" && finalBackURL != "" {
-			s.setTokenIdHandler().ServeHTTP(w, r)
+		if s.publicRoutes.Match(r) {
+			next.ServeHTTP(w, r)
 			return
 		}
 
-		// URL, на который IAM вернет пользователя после успешной аутентифицикации
-		backURL, err := s.getBackURL(r)
-		if err != nil {
-			if errors.Is(err, ErrEmptyReferer) {
-				w.WriteHeader(http.StatusBadRequest)
-				_, _ = w.Write([]byte(ErrEmptyReferer.Error()))
-				return
-			}
-
-			s.log.Errorf("s4F9pAY2DugXZd0 %s", err)
-			w.WriteHeader(http.StatusInternalServerError)
+		r, processed, authErr := s.authToken(w, r, true)
+		if processed {
+			return
+		}
+		if authErr != nil {
+			s.respondError(w, r, authErr)
 			return
 		}
 
-		// Проверяем id токена в куках
-		tokenIdCk, err := r.Cookie(CookieName_TokenId)
-		if err != nil {
-			// Куки нет, дергаем ручку IAM getAuthLink и отдаем 401 со ссылкой в ответе
-			authLinkResponse, err := s.iamClient.GetAuthLink(backURL)
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				return
-			}
+		next.ServeHTTP(w, r)
+	})
+}
 
-			s.returnRedirectJSON(w, authLinkResponse.RedirectUrl)
-			return
+// authToken аутентифицирует пользователя по кукам (user2app), общая часть для net/http и echo.
+// Если это запрос после аутентификации в IAM, сам отдает редирект, в этом случае возвращает processed = true.
+// При validateOnly = true у IAM проверяется только валидность токена, права в контекст не кладутся.
+func (s *Service) authToken(w http.ResponseWriter, r *http.Request, validateOnly bool) (_ *http.Request, processed bool, authErr *AuthError) {
+	// Если это запрос после аутентификации в IAM, обрабатываем его
+	q := r.URL.Query()
+	code := q.Get("code")
+	finalBackURL := q.Get("finalBackURL")
+	if code != "" && finalBackURL != "" {
+		s.setTokenIdHandler().ServeHTTP(w, r)
+		return r, true, nil
+	}
+
+	// URL, на который IAM вернет пользователя после успешной аутентифицикации
+	backURL, err := s.getBackURL(r)
+	if err != nil {
+		if errors.Is(err, ErrEmptyReferer) {
+			return r, false, &AuthError{Status: http.StatusBadRequest, Reason: ReasonEmptyReferer, Message: ErrEmptyReferer.Error(), Err: err}
 		}
 
-		// Кука есть - запрашиваем у IAM пермишены по ручке getTokenPermissions
-		tokenId, err := url.QueryUnescape(tokenIdCk.Value)
+		s.log.Errorf("s4F9pAY2DugXZd0 %s", err)
+		return r, false, &AuthError{Status: http.StatusInternalServerError, Reason: ReasonInternal, Err: err}
+	}
+
+	// Проверяем id токена в куках
+	tokenIdCk, err := r.Cookie(CookieName_TokenId)
+	if err != nil {
+		// Куки нет, дергаем ручку IAM getAuthLink и отдаем 401 со ссылкой в ответе
+		authLinkResponse, err := s.iamClient.GetAuthLink(backURL)
 		if err != nil {
-			s.log.Errorf("91sfK8v3s0QB5k9 %s", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+			return r, false, &AuthError{Status: http.StatusInternalServerError, Reason: ReasonIamUnavailable, Err: err}
 		}
 
+		return r, false, &AuthError{Status: http.StatusUnauthorized, Reason: ReasonUnauthenticated, RedirectURL: authLinkResponse.RedirectUrl}
+	}
+
+	tokenId, err := url.QueryUnescape(tokenIdCk.Value)
+	if err != nil {
+		s.log.Errorf("91sfK8v3s0QB5k9 %s", err)
+		return r, false, &AuthError{Status: http.StatusInternalServerError, Reason: ReasonInternal, Err: err}
+	}
+
+	if validateOnly {
 		resp, err := s.iamClient.IsTokenValid(tokenId)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+			return r, false, &AuthError{Status: http.StatusInternalServerError, Reason: ReasonIamUnavailable, Err: err}
 		}
 
 		// Токен невалиден, отдаем 401
 		if !resp.Success {
-			w.WriteHeader(http.StatusUnauthorized)
-			return
+			return r, false, &AuthError{Status: http.StatusUnauthorized, Reason: ReasonTokenRejected}
 		}
 
 		// Токен валиден, пропускаем
-		next.ServeHTTP(w, r)
-	})
+		return r, false, nil
+	}
+
+	// Кука есть - запрашиваем у IAM пермишены по ручке getTokenPermissions
+	resp, err := s.iamClient.GetTokenPermissions(tokenId, s.serviceId, backURL)
+	if err != nil {
+		return r, false, &AuthError{Status: http.StatusInternalServerError, Reason: ReasonIamUnavailable, Err: err}
+	}
+
+	// Отправляем юзера на аутентификацию в IAM
+	if resp.HttpStatus == http.StatusUnauthorized {
+		return r, false, &AuthError{Status: http.StatusUnauthorized, Reason: ReasonUnauthenticated, RedirectURL: resp.RedirectUrl}
+	}
+
+	// Получен не 200 и не 401, отдаем статус как есть
+	if resp.HttpStatus != http.StatusOK {
+		return r, false, &AuthError{Status: resp.HttpStatus, Reason: ReasonTokenRejected}
+	}
+
+	// Добавляем содержимое куки CookieName_UserEmail как userId
+	var userEmail string
+	userEmailCk, err := r.Cookie(CookieName_UserEmail)
+	if err != nil {
+		// Такого быть не должно ругнемся в лог
+		s.log.Errorf("No cookie %s", CookieName_UserEmail)
+	} else {
+		userEmail, err = url.QueryUnescape(userEmailCk.Value)
+		if err != nil {
+			s.log.Errorf("6k5X83JDf2cI11V %s", err)
+		}
+	}
+
+	// Все хорошо, кладем права и id в контекст (одной копией запроса) и идем дальше
+	ctx := context.WithValue(s.withErrorResponder(r.Context()), CtxIamPermissions{}, resp.Permissions)
+	r = r.WithContext(context.WithValue(ctx, CtxIamUserId{}, userEmail))
+
+	return r, false, nil
 }
 
 func InArray[T comparable](a []T, x T) bool {
@@ -253,44 +275,65 @@ func InArray[T comparable](a []T, x T) bool {
 func (s *Service) EchoAuthAccessKey(c echo.Context, next echo.HandlerFunc) (processed bool, err error) {
 	r := c.Request()
 
-	// Проверяем наличие хедеров X-Access-Key
-	accessKey := r.Header.Get(HeaderAccessKey)
+	// Проверяем наличие ключа доступа
+	accessKey := s.extractAccessKey(r)
 	if accessKey == "" {
 		return
 	}
 
-	// Ключ в хедере есть, полностью берем обработку запроса на себя
+	// Ключ есть, полностью берем обработку запроса на себя
 	processed = true
 
-	// Запрашиваем у IAM пермишены
-	resp, err := s.iamClient.GetAccessKeyPermissions(accessKey, s.serviceId)
-	if err != nil {
-		c.String(http.StatusInternalServerError, "Internal Server Error")
+	r, authErr := s.checkAccessKey(r, accessKey)
+	if authErr != nil {
+		err = s.echoRespondError(c, authErr)
 		return
 	}
 
-	// Все хорошо, кладем права в контекст и идем дальше
-	if resp.HttpStatus == http.StatusOK {
-		r = r.WithContext(context.WithValue(r.Context(), CtxIamPermissions{}, resp.Permissions))
+	c.SetRequest(r)
+	s.echoContextKeys.set(c, r)
 
-		r = r.WithContext(context.WithValue(r.Context(), CtxIamUserId{}, resp.UserId))
+	err = next(c)
 
-		c.SetRequest(r)
+	return
+}
 
-		err = next(c)
-		return
-	}
+// EchoAccessKeyOnlyMiddleware - аналог AccessKeyOnlyMiddleware, написанный под роутер echo
+func (s *Service) EchoAccessKeyOnlyMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if s.publicRoutes.Match(c.Request()) {
+				return next(c)
+			}
 
-	// Получен не 200, отдаем статус как есть
-	c.String(resp.HttpStatus, "")
+			r := c.Request()
 
-	return
+			accessKey := s.extractAccessKey(r)
+			if accessKey == "" {
+				return s.echoRespondError(c, &AuthError{Status: http.StatusUnauthorized, Reason: ReasonAccessKeyMissing})
+			}
+
+			r, authErr := s.checkAccessKey(r, accessKey)
+			if authErr != nil {
+				return s.echoRespondError(c, authErr)
+			}
+
+			c.SetRequest(r)
+			s.echoContextKeys.set(c, r)
+
+			return next(c)
+		}
+	}
 }
 
 // EchoAuthMiddlewareHandler - аналог AuthMiddlewareHandler, написанный под роутер echo
 func (s *Service) EchoAuthMiddlewareHandler() echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
+			if s.publicRoutes.Match(c.Request()) {
+				return next(c)
+			}
+
 			// Шаг 1. Авторизация приложения по ключу доступа (app2app)
 			// Схема авторизации app2app отличается от user2app в основном тем,
 			// что в ней нет редиректа в IAM за аутентификацией
@@ -299,94 +342,40 @@ func (s *Service) EchoAuthMiddlewareHandler() echo.MiddlewareFunc {
 				return err
 			}
 
-			r := c.Request()
-			w := c.Response().Writer
-
 			// Шаг 2. Авторизация пользователя (user2app)
-			// Если это запрос после аутентификации в IAM, обрабатываем его
-			q := r.URL.Query()
-			code := q.Get("code")
-			finalBackURL := q.Get("finalBackURL")
-			if code != "" && finalBackURL != "" {
-				s.setTokenIdHandler().ServeHTTP(w, r)
+			r, processed, authErr := s.authToken(c.Response(), c.Request(), false)
+			if processed {
 				return nil
 			}
-
-			// URL, на который IAM вернет пользователя после успешной аутентифицикации
-			backURL, err := s.getBackURL(r)
-			if err != nil {
-				if errors.Is(err, ErrEmptyReferer) {
-					w.WriteHeader(http.StatusBadRequest)
-					_, _ = w.Write([]byte(ErrEmptyReferer.Error()))
-					return nil
-				}
-
-				s.log.Errorf("s4F9pAY2DugXZd0 %s", err)
-				w.WriteHeader(http.StatusInternalServerError)
-				return nil
+			if authErr != nil {
+				return s.echoRespondError(c, authErr)
 			}
 
-			// Проверяем id токена в куках
-			tokenIdCk, err := r.Cookie(CookieName_TokenId)
-			if err != nil {
-				// Куки нет, дергаем ручку IAM getAuthLink и отдаем 401 со ссылкой в ответе
-				authLinkResponse, err := s.iamClient.GetAuthLink(backURL)
-				if err != nil {
-					w.WriteHeader(http.StatusInternalServerError)
-					return nil
-				}
-
-				s.returnRedirectJSON(w, authLinkResponse.RedirectUrl)
-				return nil
-			}
+			c.SetRequest(r)
+			s.echoContextKeys.set(c, r)
 
-			// Кука есть - запрашиваем у IAM пермишены по ручке getTokenPermissions
-			tokenId, err := url.QueryUnescape(tokenIdCk.Value)
-			if err != nil {
-				s.log.Errorf("91sfK8v3s0QB5k9 %s", err)
-				w.WriteHeader(http.StatusInternalServerError)
-				return nil
-			}
+			return next(c)
+		}
+	}
+}
 
-			resp, err := s.iamClient.GetTokenPermissions(tokenId, s.serviceId, backURL)
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				return nil
+// EchoSimpleAuthMiddlewareHandler - аналог SimpleAuthMiddlewareHandler, написанный под роутер echo
+func (s *Service) EchoSimpleAuthMiddlewareHandler() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if s.publicRoutes.Match(c.Request()) {
+				return next(c)
 			}
 
-			// Отправляем юзера на аутентификацию
-			if resp.HttpStatus == http.StatusUnauthorized {
-				s.returnRedirectJSON(w, resp.RedirectUrl)
+			_, processed, authErr := s.authToken(c.Response(), c.Request(), true)
+			if processed {
 				return nil
 			}
-
-			// Все хорошо, кладем права в контекст и идем дальше
-			if resp.HttpStatus == http.StatusOK {
-				r = r.WithContext(context.WithValue(r.Context(), CtxIamPermissions{}, resp.Permissions))
-
-				// Добавляем содержимое куки CookieName_UserEmail как userId
-				var userEmail string
-				userEmailCk, err := r.Cookie(CookieName_UserEmail)
-				if err != nil {
-					// Такого быть не должно ругнемся в лог
-					s.log.Errorf("No cookie %s", CookieName_UserEmail)
-				} else {
-					userEmail, err = url.QueryUnescape(userEmailCk.Value)
-					if err != nil {
-						s.log.Errorf("6k5X83JDf2cI11V %s", err)
-					}
-				}
-				r = r.WithContext(context.WithValue(r.Context(), CtxIamUserId{}, userEmail))
-
-				c.SetRequest(r)
-
-				return next(c)
+			if authErr != nil {
+				return s.echoRespondError(c, authErr)
 			}
 
-			// Получен не 200 и не 401, отдаем статус как есть
-			w.WriteHeader(resp.HttpStatus)
-
-			return nil
+			return next(c)
 		}
 	}
 }
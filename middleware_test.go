@@ -0,0 +1,221 @@
+package iam_client
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Debugf(string, ...interface{})   {}
+func (nopLogger) Infof(string, ...interface{})    {}
+func (nopLogger) Warningf(string, ...interface{}) {}
+func (nopLogger) Errorf(string, ...interface{})   {}
+
+// newTestIam поднимает фейковый IAM, который по ключу "valid" выдает права, а остальные ключи отвергает с 403.
+// Валидным считается только токен "valid".
+func newTestIam(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v2/getAccessKeyPermissions", func(w http.ResponseWriter, r *http.Request) {
+		var req IAMGetAccessKeyPermissionsRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.Key != "valid" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(IAMGetTokenPermissionsResponse{
+			HttpStatus:  http.StatusOK,
+			Permissions: []string{"view:log"},
+			UserId:      "some_app",
+		})
+	})
+	mux.HandleFunc("/api/v2/isTokenValid", func(w http.ResponseWriter, r *http.Request) {
+		var req IAMIsTokenValidRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		_ = json.NewEncoder(w).Encode(IAMResponseSuccess{Success: req.Id == "valid"})
+	})
+	mux.HandleFunc("/api/v2/getAuthLink", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(IAMGetAuthLinkResponse{RedirectUrl: "https://keycloak/auth"})
+	})
+
+	iam := httptest.NewServer(mux)
+	t.Cleanup(iam.Close)
+
+	return iam
+}
+
+func TestService_AccessKeyOnlyMiddleware(t *testing.T) {
+	iam := newTestIam(t)
+	s := New("some_service", Config{IamUrl: iam.URL}, nopLogger{})
+
+	var gotUserId string
+	handler := s.AccessKeyOnlyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUserId = GetUserId(r.Context())
+	}))
+
+	tests := []struct {
+		name       string
+		accessKey  string
+		wantStatus int
+		wantUserId string
+	}{
+		{
+			name:       "No key",
+			wantStatus: http.StatusUnauthorized,
+		},
+
+		{
+			name:       "Key rejected by IAM",
+			accessKey:  "invalid",
+			wantStatus: http.StatusForbidden,
+		},
+
+		{
+			name:       "Valid key",
+			accessKey:  "valid",
+			wantStatus: http.StatusOK,
+			wantUserId: "some_app",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotUserId = ""
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/hook", nil)
+			if tt.accessKey != "" {
+				r.Header.Set(HeaderAccessKey, tt.accessKey)
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if gotUserId != tt.wantUserId {
+				t.Errorf("userId = %v, want %v", gotUserId, tt.wantUserId)
+			}
+		})
+	}
+}
+
+func TestService_EchoSimpleAuthMiddlewareHandler(t *testing.T) {
+	iam := newTestIam(t)
+	s := New("some_service", Config{IamUrl: iam.URL}, nopLogger{})
+	e := echo.New()
+
+	handler := s.EchoSimpleAuthMiddlewareHandler()(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	tests := []struct {
+		name         string
+		tokenId      string
+		wantStatus   int
+		wantRedirect bool
+	}{
+		{
+			name:         "No cookie",
+			wantStatus:   http.StatusUnauthorized,
+			wantRedirect: true,
+		},
+
+		{
+			name:       "Invalid token",
+			tokenId:    "expired",
+			wantStatus: http.StatusUnauthorized,
+		},
+
+		{
+			name:       "Valid token",
+			tokenId:    "valid",
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/iam/v2/permissions", nil)
+			r.Header.Set("Referer", "https://admin/")
+			if tt.tokenId != "" {
+				r.AddCookie(&http.Cookie{Name: CookieName_TokenId, Value: tt.tokenId})
+			}
+			w := httptest.NewRecorder()
+
+			if err := handler(e.NewContext(r, w)); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			var body link401
+			_ = json.Unmarshal(w.Body.Bytes(), &body)
+			if (body.RedirectURL != "") != tt.wantRedirect {
+				t.Errorf("redirect_url = %q, want redirect %v", body.RedirectURL, tt.wantRedirect)
+			}
+		})
+	}
+}
+
+func TestService_WithEchoHTTPErrors(t *testing.T) {
+	iam := newTestIam(t)
+	s := New("some_service", Config{IamUrl: iam.URL}, nopLogger{})
+	s.WithEchoHTTPErrors(true)
+	e := echo.New()
+
+	handler := s.EchoAuthMiddlewareHandler()(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/admin/actionLog", nil)
+	r.Header.Set("Referer", "https://admin/")
+	w := httptest.NewRecorder()
+
+	err := handler(e.NewContext(r, w))
+
+	var he *echo.HTTPError
+	if !errors.As(err, &he) || he.Code != http.StatusUnauthorized {
+		t.Fatalf("error = %v, want *echo.HTTPError with status 401", err)
+	}
+	var authErr *AuthError
+	if !errors.As(err, &authErr) || authErr.Reason != ReasonUnauthenticated || authErr.RedirectURL == "" {
+		t.Errorf("AuthError = %+v, want unauthenticated with redirect URL", authErr)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("middleware wrote the response itself: %q", w.Body.String())
+	}
+}
+
+func TestService_EchoContextKeys(t *testing.T) {
+	iam := newTestIam(t)
+	s := New("some_service", Config{IamUrl: iam.URL}, nopLogger{})
+	keys := EchoContextKeys{Principal: "p", Permissions: "perms", UserId: "uid"}
+	s.WithEchoContextKeys(keys)
+	e := echo.New()
+
+	var principal Principal
+	var found bool
+	handler := s.EchoAccessKeyOnlyMiddleware()(func(c echo.Context) error {
+		principal, found = keys.GetPrincipal(c)
+		if keys.GetUserId(c) != "some_app" || !reflect.DeepEqual(keys.GetPermissions(c), []string{"view:log"}) {
+			t.Errorf("unexpected echo.Context values: %v, %v", keys.GetUserId(c), keys.GetPermissions(c))
+		}
+		return nil
+	})
+
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/hook", nil)
+	r.Header.Set(HeaderAccessKey, "valid")
+
+	if err := handler(e.NewContext(r, httptest.NewRecorder())); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !found || principal.UserId != "some_app" {
+		t.Errorf("Principal = %+v, found %v", principal, found)
+	}
+}
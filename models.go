@@ -59,3 +59,34 @@ type IAMIsTokenValidRequest struct {
 type IAMResponseSuccess struct {
 	Success bool `json:"success"`
 }
+
+type IAMPermission struct {
+	// Name Право, например, "edit:category"
+	Name string `json:"name"`
+
+	// Description Описание права для админки IAM
+	Description string `json:"description,omitempty"`
+}
+
+type IAMUpsertPermissionsRequest struct {
+	// ServiceId ID сервиса, права которого регистрируются
+	ServiceId string `json:"service_id"`
+
+	// Permissions Полный каталог прав сервиса
+	Permissions []IAMPermission `json:"permissions"`
+}
+
+// IAMGetRoutePolicyResponse матрица доступа сервиса, полученная из IAM
+type IAMGetRoutePolicyResponse struct {
+	// HttpStatus HTTP статус ответа IAM
+	HttpStatus int
+
+	// ETag версия матрицы, передается в следующий запрос, чтобы не скачивать ее повторно
+	ETag string
+
+	// NotModified матрица не изменилась с версии, переданной в запросе, PermissionsMatrix пустая
+	NotModified bool
+
+	// PermissionsMatrix матрица доступа в формате NewPermissionsChecker
+	PermissionsMatrix map[string][]string
+}
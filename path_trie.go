@@ -0,0 +1,302 @@
+package iam_client
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// pathTrie префиксное дерево шаблонов путей, встроенный матчер матрицы доступа для сервисов без роутера.
+// Поддерживаемые сегменты шаблона:
+//   - статический сегмент, например, "category";
+//   - макрос {name}, совпадает с любым непустым сегментом;
+//   - сегмент с регуляркой или несколькими макросами, например, {id:[0-9]+} или {name}.{ext};
+//   - "*", совпадает с любым непустым сегментом, значение не сохраняется;
+//   - "**" в конце шаблона, совпадает с остатком пути (ноль и более сегментов).
+//
+// При нескольких подходящих шаблонах побеждает самый конкретный: сегменты сравниваются слева направо,
+// и в каждой позиции статический сегмент важнее сегмента с регуляркой, тот важнее {name},
+// {name} важнее "*", а "*" важнее "**".
+type pathTrie[T any] struct {
+	root pathTrieNode[T]
+}
+
+type pathTrieNode[T any] struct {
+	static   map[string]*pathTrieNode[T]
+	regexps  []*pathTrieNode[T]
+	params   []*pathTrieNode[T]
+	star     *pathTrieNode[T]
+	catchAll *pathTrieNode[T]
+
+	// segmentRe регулярка сегмента для узлов из regexps, segmentSrc - ее исходный шаблон
+	segmentRe  *regexp.Regexp
+	segmentSrc string
+	// paramName имя макроса для узлов из params
+	paramName string
+
+	hasValue bool
+	value    T
+	pattern  string
+}
+
+// pathParam значение макроса пути
+type pathParam struct {
+	Name  string
+	Value string
+}
+
+// insert добавляет шаблон в дерево. Если такой шаблон уже есть, возвращает существующее значение и false.
+func (t *pathTrie[T]) insert(pattern string, value T) (existing T, inserted bool, err error) {
+	segments := splitPath(pattern)
+	node := &t.root
+	for i, segment := range segments {
+		switch {
+		case segment == "**":
+			if i != len(segments)-1 {
+				return existing, false, errors.Errorf("path %q: \"**\" is allowed only at the end", pattern)
+			}
+			if node.catchAll == nil {
+				node.catchAll = &pathTrieNode[T]{}
+			}
+			node = node.catchAll
+
+		case segment == "*":
+			if node.star == nil {
+				node.star = &pathTrieNode[T]{}
+			}
+			node = node.star
+
+		case isSimpleParam(segment):
+			name := segment[1 : len(segment)-1]
+			child := node.findParam(name)
+			if child == nil {
+				child = &pathTrieNode[T]{paramName: name}
+				node.params = append(node.params, child)
+			}
+			node = child
+
+		case strings.ContainsRune(segment, '{'):
+			child := node.findRegexp(segment)
+			if child == nil {
+				re, err := compileSegment(segment)
+				if err != nil {
+					return existing, false, errors.Wrapf(err, "path %q", pattern)
+				}
+				child = &pathTrieNode[T]{segmentRe: re, segmentSrc: segment}
+				node.regexps = append(node.regexps, child)
+			}
+			node = child
+
+		default:
+			if node.static == nil {
+				node.static = make(map[string]*pathTrieNode[T])
+			}
+			child, found := node.static[segment]
+			if !found {
+				child = &pathTrieNode[T]{}
+				node.static[segment] = child
+			}
+			node = child
+		}
+	}
+
+	if node.hasValue {
+		return node.value, false, nil
+	}
+	node.hasValue = true
+	node.value = value
+	node.pattern = pattern
+
+	return value, true, nil
+}
+
+// match ищет самый конкретный шаблон, совпадающий с path, значение которого удовлетворяет accept.
+// accept позволяет пропустить шаблон (например, без правила для нужного метода) и продолжить поиск.
+func (t *pathTrie[T]) match(path string, accept func(T) bool) (value T, pattern string, params []pathParam, found bool) {
+	var segmentsBuf [maxStackSegments]string
+	node := t.root.match(appendPathSegments(segmentsBuf[:0], path), 0, &params, accept)
+	if node == nil {
+		return value, "", nil, false
+	}
+	if len(params) == 0 {
+		params = nil
+	}
+
+	return node.value, node.pattern, params, true
+}
+
+// lookup - match без сбора параметров пути. Для типичных путей не аллоцирует память
+func (t *pathTrie[T]) lookup(path string, accept func(T) bool) (value T, found bool) {
+	var segmentsBuf [maxStackSegments]string
+	node := t.root.match(appendPathSegments(segmentsBuf[:0], path), 0, nil, accept)
+	if node == nil {
+		return value, false
+	}
+
+	return node.value, true
+}
+
+// maxStackSegments число сегментов пути, которые разбираются без выделения памяти в куче
+const maxStackSegments = 16
+
+// appendPathSegments - splitPath, который дописывает сегменты в segments
+func appendPathSegments(segments []string, path string) []string {
+	path = strings.TrimPrefix(path, "/")
+	for {
+		segment, rest, more := strings.Cut(path, "/")
+		segments = append(segments, segment)
+		if !more {
+			return segments
+		}
+		path = rest
+	}
+}
+
+// match ищет узел для segments[i:]. Если params равен nil, параметры пути не собираются
+func (n *pathTrieNode[T]) match(segments []string, i int, params *[]pathParam, accept func(T) bool) *pathTrieNode[T] {
+	if i == len(segments) {
+		if n.hasValue && (accept == nil || accept(n.value)) {
+			return n
+		}
+		// "**" совпадает и с пустым остатком пути
+		if n.catchAll != nil && n.catchAll.hasValue && (accept == nil || accept(n.catchAll.value)) {
+			return n.catchAll
+		}
+		return nil
+	}
+
+	segment := segments[i]
+	if child, found := n.static[segment]; found {
+		if result := child.match(segments, i+1, params, accept); result != nil {
+			return result
+		}
+	}
+
+	if segment != "" {
+		for _, child := range n.regexps {
+			if params == nil {
+				if !child.segmentRe.MatchString(segment) {
+					continue
+				}
+				if result := child.match(segments, i+1, nil, accept); result != nil {
+					return result
+				}
+				continue
+			}
+
+			submatches := child.segmentRe.FindStringSubmatch(segment)
+			if submatches == nil {
+				continue
+			}
+			mark := len(*params)
+			for j, name := range child.segmentRe.SubexpNames() {
+				if name != "" {
+					*params = append(*params, pathParam{Name: name, Value: submatches[j]})
+				}
+			}
+			if result := child.match(segments, i+1, params, accept); result != nil {
+				return result
+			}
+			*params = (*params)[:mark]
+		}
+
+		for _, child := range n.params {
+			mark := 0
+			if params != nil {
+				mark = len(*params)
+				*params = append(*params, pathParam{Name: child.paramName, Value: segment})
+			}
+			if result := child.match(segments, i+1, params, accept); result != nil {
+				return result
+			}
+			if params != nil {
+				*params = (*params)[:mark]
+			}
+		}
+
+		if n.star != nil {
+			if result := n.star.match(segments, i+1, params, accept); result != nil {
+				return result
+			}
+		}
+	}
+
+	if n.catchAll != nil && n.catchAll.hasValue && (accept == nil || accept(n.catchAll.value)) {
+		return n.catchAll
+	}
+
+	return nil
+}
+
+func (n *pathTrieNode[T]) findRegexp(segment string) *pathTrieNode[T] {
+	for _, child := range n.regexps {
+		if child.segmentSrc == segment {
+			return child
+		}
+	}
+
+	return nil
+}
+
+func (n *pathTrieNode[T]) findParam(name string) *pathTrieNode[T] {
+	for _, child := range n.params {
+		if child.paramName == name {
+			return child
+		}
+	}
+
+	return nil
+}
+
+// splitPath разбивает путь на сегменты без ведущего "/"
+func splitPath(path string) []string {
+	return strings.Split(strings.TrimPrefix(path, "/"), "/")
+}
+
+// isSimpleParam проверяет, что сегмент - это макрос {name} без регулярки
+func isSimpleParam(segment string) bool {
+	return len(segment) > 2 && segment[0] == '{' && segment[len(segment)-1] == '}' &&
+		matrixParamNameRe.MatchString(segment[1:len(segment)-1])
+}
+
+// compileSegment превращает сегмент с макросами ({name}, {name:regexp}) в регулярку с именованными группами
+func compileSegment(segment string) (*regexp.Regexp, error) {
+	var expr strings.Builder
+	expr.WriteByte('^')
+	for segment != "" {
+		start := strings.IndexByte(segment, '{')
+		if start < 0 {
+			expr.WriteString(regexp.QuoteMeta(segment))
+			break
+		}
+		expr.WriteString(regexp.QuoteMeta(segment[:start]))
+
+		// Регулярка может содержать свои фигурные скобки, например, {id:[0-9]{3}}
+		depth, end := 0, -1
+		for i := start; i < len(segment) && end < 0; i++ {
+			switch segment[i] {
+			case '{':
+				depth++
+			case '}':
+				depth--
+				if depth == 0 {
+					end = i
+				}
+			}
+		}
+		if end < 0 {
+			return nil, errors.New("unbalanced braces")
+		}
+
+		name, pattern, hasPattern := strings.Cut(segment[start+1:end], ":")
+		if !hasPattern {
+			pattern = "[^/]+"
+		}
+		expr.WriteString("(?P<" + name + ">" + pattern + ")")
+		segment = segment[end+1:]
+	}
+	expr.WriteByte('$')
+
+	return regexp.Compile(expr.String())
+}
@@ -0,0 +1,117 @@
+package iam_client
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPathTrie_match(t *testing.T) {
+	var trie pathTrie[string]
+	patterns := []string{
+		"/api/v1/category",
+		"/api/v1/category/{id}",
+		"/api/v1/category/{id:[0-9]+}",
+		"/api/v1/category/new",
+		"/api/v1/category/{id}/items/*",
+		"/api/v1/files/{name}.{ext}",
+		"/api/v1/static/**",
+		"/api/**",
+	}
+	for _, pattern := range patterns {
+		if _, _, err := trie.insert(pattern, pattern); err != nil {
+			t.Fatalf("insert(%q) error = %s", pattern, err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		path        string
+		wantPattern string
+		wantParams  []pathParam
+	}{
+		{
+			name:        "Static path",
+			path:        "/api/v1/category",
+			wantPattern: "/api/v1/category",
+		},
+
+		{
+			name:        "Static segment beats macros",
+			path:        "/api/v1/category/new",
+			wantPattern: "/api/v1/category/new",
+		},
+
+		{
+			name:        "Macro with a regexp beats a simple macro",
+			path:        "/api/v1/category/123",
+			wantPattern: "/api/v1/category/{id:[0-9]+}",
+			wantParams:  []pathParam{{Name: "id", Value: "123"}},
+		},
+
+		{
+			name:        "Simple macro",
+			path:        "/api/v1/category/books",
+			wantPattern: "/api/v1/category/{id}",
+			wantParams:  []pathParam{{Name: "id", Value: "books"}},
+		},
+
+		{
+			name:        "Single segment wildcard",
+			path:        "/api/v1/category/books/items/42",
+			wantPattern: "/api/v1/category/{id}/items/*",
+			wantParams:  []pathParam{{Name: "id", Value: "books"}},
+		},
+
+		{
+			name:        "Several macros in a segment",
+			path:        "/api/v1/files/report.pdf",
+			wantPattern: "/api/v1/files/{name}.{ext}",
+			wantParams:  []pathParam{{Name: "name", Value: "report"}, {Name: "ext", Value: "pdf"}},
+		},
+
+		{
+			name:        "Trailing wildcard",
+			path:        "/api/v1/static/js/app.js",
+			wantPattern: "/api/v1/static/**",
+		},
+
+		{
+			name:        "Trailing wildcard matches an empty rest",
+			path:        "/api/v1/static",
+			wantPattern: "/api/v1/static/**",
+		},
+
+		{
+			name:        "Less specific trailing wildcard after a failed branch",
+			path:        "/api/v1/category/books/items",
+			wantPattern: "/api/**",
+		},
+
+		{
+			name: "No match",
+			path: "/health",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, pattern, params, found := trie.match(tt.path, nil)
+			if found != (tt.wantPattern != "") || pattern != tt.wantPattern {
+				t.Errorf("match() pattern = %q, want %q", pattern, tt.wantPattern)
+			}
+			if !reflect.DeepEqual(params, tt.wantParams) {
+				t.Errorf("match() params = %v, want %v", params, tt.wantParams)
+			}
+		})
+	}
+}
+
+func TestPathTrie_matchWithAccept(t *testing.T) {
+	var trie pathTrie[string]
+	_, _, _ = trie.insert("/api/v1/category/{id}", "POST")
+	_, _, _ = trie.insert("/api/v1/category/*", "GET")
+
+	_, pattern, _, _ := trie.match("/api/v1/category/1", func(method string) bool { return method == "GET" })
+	if pattern != "/api/v1/category/*" {
+		t.Errorf("match() pattern = %q, want the less specific pattern accepted by the predicate", pattern)
+	}
+}
@@ -1,9 +1,11 @@
 package iam_client
 
 import (
-	"context"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"unsafe"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/gorilla/mux"
@@ -13,27 +15,80 @@ import (
 // NewPermissionsChecker возвращает объект типа Permissions, который
 // используется для проверки прав доступа к конкретным ручкам.
 // permissionsMatrix - это матрица доступа map[string][]string вида
-// METHOD/URL => []string{ALLOWED_PERMISSION1[:SCOPE], ALLOWED_PERMISSION2[:SCOPE], ...}
+// METHOD/URL => []string{ALLOWED_PERMISSION1[:SCOPE...], ALLOWED_PERMISSION2[:SCOPE...], ...}
 // Например:
 // POST/api/v2/admin/grant => []string{"admin:activate", "admin:promote"}
 // GET/api/v1/admin/actionLog => []string{"admin", "view:log"}
+// Если тип доступа указан без скоупа, пускаем с любым скоупом.
+// Скоупы могут быть многоуровневыми: "edit:category:123" дают "edit:category:*", "edit:category" и "edit",
+// правила сравнения описаны у permissionGranted.
+// Скоуп может ссылаться на параметр пути: "DELETE/api/v1/category/{id}" => []string{"edit:category:{id}"}
+// пустит на /api/v1/category/42 пользователя с "edit:category:42" (или "edit:category:*").
+// Элемент списка может быть выражением с И/ИЛИ: "edit:category & (approve:* | admin)".
 //
-// Если тип доступа указан без скоупа, пускаем с любым скоупом
+// Вместо METHOD можно указать список методов "GET|HEAD" или "ANY" для всех методов.
+// Для одного пути ключ с конкретным методом важнее списка методов, а список важнее ANY.
+// HEAD без своего правила проверяется по правилу GET (до ANY). На OPTIONS ANY распространяется
+// только при политике OptionsMatrix, см. WithOptionsPolicy.
+// Сначала выбирается самый конкретный путь, у которого есть правило для метода, и только потом метод.
+//
+// В путях можно использовать макросы {param} и {param:regexp}, "*" (любой один сегмент)
+// и "**" в конце пути (любой остаток). Если роутер не подключен через WithGorillaMuxRouter
+// или WithChiMuxRouter, такие пути ищутся встроенным матчером, при нескольких совпадениях
+// побеждает самый конкретный путь.
+//
+// Некорректная матрица не мешает созданию: ошибки пишутся в лог, а права, которые не разбираются
+// как выражения (или ссылаются на неизвестные параметры пути), сравниваются как есть - так же, как
+// до появления выражений. Чтобы не запускаться с такой матрицей, ее стоит проверить ValidatePermissionsMatrix.
 func NewPermissionsChecker(permissionsMatrix map[string][]string, log Logger) *PermissionsChecker {
+	globalRules, _ := compileGlobalRules(DefaultGlobalRules())
 	p := PermissionsChecker{
-		permissionsMatrix: permissionsMatrix,
-		log:               log,
+		log:             log,
+		echoContextKeys: DefaultEchoContextKeys,
+		globalRules:     globalRules,
 	}
+	// Ошибки не фатальны: пути с ошибками не найдутся встроенным матчером, а права, которые не разбираются
+	// как выражения, сравниваются как есть (см. legacyRequirement), как до появления выражений
+	snapshot, err := newMatrixSnapshot(permissionsMatrix)
+	if err != nil && log != nil {
+		log.Errorf("I3TalH53MA4jTbb invalid permissions matrix: %s", err)
+	}
+	p.matrix.Store(snapshot)
 
 	return &p
 }
 
 // PermissionsChecker используется для проверки прав доступа к конкретным ручкам
 type PermissionsChecker struct {
-	permissionsMatrix map[string][]string
-	log               Logger
-	gorillaMuxRouter  *mux.Router
-	chiMuxRouter      *chi.Mux
+	// matrix текущая матрица доступа, подменяется атомарно, см. ReplacePermissionsMatrix
+	matrix           atomic.Pointer[matrixSnapshot]
+	log              Logger
+	gorillaMuxRouter *mux.Router
+	chiMuxRouter     *chi.Mux
+	echoHTTPErrors   bool
+	echoContextKeys  EchoContextKeys
+	optionsPolicy    OptionsPolicy
+	decisionDebug    DecisionDebug
+	publicRoutes     *PublicRoutes
+	// enforcementMode, routeEnforcement и shadowHook задают режим shadow, см. WithEnforcementMode
+	enforcementMode  EnforcementMode
+	routeEnforcement map[string]EnforcementMode
+	shadowHook       ShadowHook
+	// errorResponder отрисовывает 403, без него - ErrorResponder сервиса или пустой 403, см. WithErrorResponder
+	errorResponder ErrorResponder
+	// forbiddenDetails отдавать в 403 ключ матрицы и права, см. WithForbiddenDetails
+	forbiddenDetails bool
+	// roles определения ролей для раскрытия "role:name", см. WithRoles
+	roles *Roles
+	// requireMu защищает requirements - требования всех вызовов Require (см. PermissionCatalog),
+	// requireMiddlewares - middleware из Require и EchoRequire (см. funcId)
+	// и echoRequireRoutes - ручки echo с EchoRequire (см. WithEchoRouter)
+	requireMu          sync.Mutex
+	requirements       []*requirement
+	requireMiddlewares map[unsafe.Pointer]bool
+	echoRequireRoutes  map[Route]bool
+	// globalRules правила, которые пускают к ручкам без поиска в матрице, см. WithGlobalRules
+	globalRules []globalRule
 }
 
 // WithGorillaMuxRouter принимает на вход объект *mux.Router и применяет его при поиске
@@ -50,58 +105,82 @@ func (p *PermissionsChecker) WithChiMuxRouter(r *chi.Mux) {
 	p.chiMuxRouter = r
 }
 
+// WithOptionsPolicy задает обработку запросов OPTIONS, по умолчанию OptionsMatrix
+func (p *PermissionsChecker) WithOptionsPolicy(policy OptionsPolicy) {
+	p.optionsPolicy = policy
+}
+
+// WithEchoHTTPErrors включает режим, в котором EchoAuthMiddlewareHandler не пишет 403 сам, а возвращает
+// *echo.HTTPError с AuthError внутри. Отрисовка ошибки в этом случае остается за HTTPErrorHandler приложения.
+func (p *PermissionsChecker) WithEchoHTTPErrors(enabled bool) {
+	p.echoHTTPErrors = enabled
+}
+
 // AuthMiddlewareHandler должен использоваться после аутентификации в IAM-клиенте.
-// С правом доступа "admin:*" пускает ко всем ручкам.
-// С правом доступа "view:*" пускает ко всем GET-ручкам.
+// По умолчанию с правом доступа "admin:*" пускает ко всем ручкам,
+// с правом доступа "view:*" - ко всем GET- и HEAD-ручкам, см. WithGlobalRules.
 // Для всех остальных прав применяется матрица доступа.
+// При политике OptionsAllow запросы OPTIONS пропускаются без проверки, как и публичные ручки (WithPublicRoutes).
+// Ручки gorilla/mux, обернутые Require, пропускаются к Require.
 func (p *PermissionsChecker) AuthMiddlewareHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
-		userPermissions := GetPermissions(ctx)
-		if len(userPermissions) == 0 {
-			// Такого быть не должно, но на всякий случай обработаем в явном виде
-			p.log.Errorf("Empty permissions from IAM client")
-			w.WriteHeader(http.StatusForbidden)
-			return
-		}
-
-		// Доступ к сервису в принципе есть, добавляем id юзера в контекст
-		r = r.WithContext(context.WithValue(ctx, CtxIamUserId{}, GetUserId(ctx)))
-
-		// С админскими правами пропускаем ко всем ручкам
-		if InArray(userPermissions, "admin:*") {
+		// Ручка, обернутая Require, проверяет права сама
+		if handler, _ := p.routeRequireHandler(r); handler != nil {
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		// С полными правами на просмотр пропускаем ко всем GET-ручкам
-		if r.Method == http.MethodGet && InArray(userPermissions, "view:*") {
-			next.ServeHTTP(w, r)
+		r = p.expandRoles(r)
+		decision := p.authorize(r, nil, nil)
+		p.debugDecision(w, r, decision)
+		if !decision.Allowed {
+			p.forbidden(w, r, decision)
 			return
 		}
 
-		// Ищем в матрице особые разрешения для данной ручки
-		allowedPermissions := p.getAllowedPermissions(r)
-		if allowedPermissions == nil {
-			w.WriteHeader(http.StatusForbidden)
-			return
-		}
+		next.ServeHTTP(w, p.withSuperPermission(r, decision))
+	})
+}
 
-		// У ручки нашлись особые разрешения, проверяем
-		if p.checkUserPermission(allowedPermissions, userPermissions) {
-			next.ServeHTTP(w, r)
-			return
-		}
+// authorize принимает решение о доступе для middleware. Отказ в режиме EnforcementShadow
+// возвращается как разрешение с Shadowed
+func (p *PermissionsChecker) authorize(r *http.Request, require *routeRequirement, requireParams []pathParam) Decision {
+	userPermissions := GetPermissions(r.Context())
+	explain := p.decisionDebug != 0
+	decision := p.decide(r, userPermissions, require, requireParams, explain)
+	if decision.Reason == ReasonEmptyPermissions {
+		// Такого быть не должно, но на всякий случай обработаем в явном виде
+		p.log.Errorf("Empty permissions from IAM client")
+	}
 
-		w.WriteHeader(http.StatusForbidden)
-	})
+	if p.shadowed(&decision) {
+		p.reportShadowDenial(r, decision)
+	}
+
+	return decision
+}
+
+// getAllowedPermissions возвращает список разрешенных прав для ручки или nil, если в матрице для нее нет правила
+func (p *PermissionsChecker) getAllowedPermissions(r *http.Request) []string {
+	rule, _, _ := p.findRule(r)
+	if rule == nil {
+		return nil
+	}
+
+	return rule.permissions
 }
 
-func (p *PermissionsChecker) getAllowedPermissions(r *http.Request) (allowedPermissions []string) {
-	var found bool
-	allowedPermissions, found = p.permissionsMatrix[r.Method+r.URL.Path]
-	if found {
-		return
+// findRule ищет правило для ручки в матрице доступа: сначала по точному пути,
+// затем по шаблону пути из роутера (gorilla/mux или chi), а если роутер не подключен - встроенным матчером.
+// Метод выбирается по правилам matrixRoute.rule. Вместе с правилом возвращаются параметры пути
+// из роутера или встроенного матчера для плейсхолдеров в правах и способ, которым найдено правило.
+func (p *PermissionsChecker) findRule(r *http.Request) (*matrixRule, []pathParam, MatchSource) {
+	snapshot := p.snapshot()
+
+	if route, found := snapshot.byPath[r.URL.Path]; found {
+		if rule := route.rule(r.Method, p.optionsPolicy); rule != nil {
+			return rule, nil, MatchExact
+		}
 	}
 
 	if p.gorillaMuxRouter != nil {
@@ -111,12 +190,16 @@ func (p *PermissionsChecker) getAllowedPermissions(r *http.Request) (allowedPerm
 			path, err := match.Route.GetPathTemplate()
 			if err != nil {
 				p.log.Errorf(err.Error())
-				return nil
+				return nil, nil, MatchNone
 			}
 
-			allowedPermissions, found = p.permissionsMatrix[r.Method+path]
-			if found {
-				return
+			if route, found := snapshot.byPath[path]; found {
+				if rule := route.rule(r.Method, p.optionsPolicy); rule != nil {
+					if !rule.bound {
+						return rule, nil, MatchGorilla
+					}
+					return rule, varsParams(match.Vars), MatchGorilla
+				}
 			}
 		}
 	}
@@ -124,74 +207,92 @@ func (p *PermissionsChecker) getAllowedPermissions(r *http.Request) (allowedPerm
 	if p.chiMuxRouter != nil {
 		rctx := chi.NewRouteContext()
 		if p.chiMuxRouter.Match(rctx, r.Method, r.URL.Path) {
-			path := rctx.RoutePattern()
-			allowedPermissions, found = p.permissionsMatrix[r.Method+path]
-			if found {
-				return
+			if route, found := snapshot.byPath[rctx.RoutePattern()]; found {
+				if rule := route.rule(r.Method, p.optionsPolicy); rule != nil {
+					if !rule.bound {
+						return rule, nil, MatchChi
+					}
+					params := make([]pathParam, 0, len(rctx.URLParams.Keys))
+					for i, name := range rctx.URLParams.Keys {
+						params = append(params, pathParam{Name: name, Value: rctx.URLParams.Values[i]})
+					}
+					return rule, params, MatchChi
+				}
 			}
 		}
 	}
 
-	return
-}
-
-// checkUserPermission проверяет, есть ли у юзера доступ, сравнивая список прав юзера со списком разрешенных доступов.
-// В списке разрешенных доступов могут быть:
-// * право со скоупом, например, "view:log". Для доступа обязательно иметь в разрешениях точное совпадение "view:log".
-// * право на все скоупы, например, "edit:*". Для доступа обязательно иметь в разрешениях точное совпадение "edit:*".
-// * право без скоупа, например, "admin". Для доступа достаточно иметь доступ "admin" с любым скоупом.
-func (p *PermissionsChecker) checkUserPermission(allowedPermissions []string, userPermissions []string) bool {
-	for _, fullPermission := range userPermissions {
-		basePermission := strings.SplitN(fullPermission, ":", 2)[0]
-		if InArray(allowedPermissions, fullPermission) || InArray(allowedPermissions, basePermission) {
-			return true
+	if p.gorillaMuxRouter == nil && p.chiMuxRouter == nil {
+		method, optionsPolicy := r.Method, p.optionsPolicy
+		accept := func(route *matrixRoute) bool {
+			return route.rule(method, optionsPolicy) != nil
+		}
+		if route, found := snapshot.routes.lookup(r.URL.Path, accept); found {
+			rule := route.rule(method, optionsPolicy)
+			if !rule.bound {
+				return rule, nil, MatchBuiltin
+			}
+			// Параметры пути собираем, только если они нужны правилу
+			_, _, params, _ := snapshot.routes.match(r.URL.Path, accept)
+			return rule, params, MatchBuiltin
 		}
 	}
 
-	return false
+	return nil, nil, MatchNone
+}
+
+// permissionGranted проверяет, дает ли право пользователя userPermission требуемое право required.
+// Права иерархические: "base:scope1:scope2:...", число уровней скоупа не ограничено.
+// Права сравниваются посегментно на общей длине:
+// * базы должны совпадать точно;
+// * сегмент скоупа совпадает, если он равен требуемому или в праве пользователя на этом уровне стоит "*".
+// "*" в требуемом праве совпадает только с "*" у пользователя;
+// * если все общие сегменты совпали, доступ есть. Более короткое право пользователя дает доступ ко всему,
+// что под ним ("edit:category" и "edit:category:*" дают "edit:category:123"), а требуемое право без
+// следующего уровня скоупа пускает с любым скоупом этого уровня ("view" пускает с "view:log:billing").
+//
+// Примеры для одноуровневых прав:
+// * "view:log" - подходят "view:log", "view:*" и "view".
+// * "edit:*" - подходят "edit:*" и "edit", "edit:promote" не подходит.
+// * "admin" - подходит "admin" с любым скоупом.
+//
+// Middleware сравнивают права через permissionIndex и заранее разобранные сегменты, см. segmentsGranted.
+func permissionGranted(required, userPermission string) bool {
+	return segmentsGranted(strings.Split(required, ":"), userPermission)
 }
 
+// EchoAuthMiddlewareHandler - аналог AuthMiddlewareHandler, написанный под роутер echo
 func (p *PermissionsChecker) EchoAuthMiddlewareHandler() echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			r := c.Request()
-			ctx := r.Context()
-			userPermissions := GetPermissions(ctx)
-			if len(userPermissions) == 0 {
-				// Такого быть не должно, но на всякий случай обработаем в явном виде
-				p.log.Errorf("Empty permissions from IAM client")
-				c.String(http.StatusForbidden, "Forbidden")
-				return nil
+			c.SetRequest(p.expandRoles(c.Request()))
+			decision := p.authorize(c.Request(), nil, nil)
+			p.debugDecision(c.Response(), c.Request(), decision)
+			if !decision.Allowed {
+				return p.echoForbidden(c, decision)
 			}
-
-			// Доступ к сервису в принципе есть, добавляем id юзера в контекст
-			r = r.WithContext(context.WithValue(ctx, CtxIamUserId{}, GetUserId(ctx)))
-			c.SetRequest(r)
-
-			// С админскими правами пропускаем ко всем ручкам
-			if InArray(userPermissions, "admin:*") {
-				return next(c)
-			}
-
-			// С полными правами на просмотр пропускаем ко всем GET-ручкам
-			if r.Method == http.MethodGet && InArray(userPermissions, "view:*") {
-				return next(c)
-			}
-
-			// Ищем в матрице особые разрешения для данной ручки
-			allowedPermissions := p.getAllowedPermissions(r)
-			if allowedPermissions == nil {
-				c.String(http.StatusForbidden, "Forbidden")
-				return nil
-			}
-
-			// У ручки нашлись особые разрешения, проверяем
-			if p.checkUserPermission(allowedPermissions, userPermissions) {
-				return next(c)
+			c.SetRequest(p.withSuperPermission(c.Request(), decision))
+			if !decision.passedThrough() {
+				p.echoContextKeys.set(c, c.Request())
 			}
 
-			c.String(http.StatusForbidden, "Forbidden")
-			return nil
+			return next(c)
 		}
 	}
 }
+
+// echoForbidden отдает 403 в echo: либо возвращает *echo.HTTPError, либо отрисовывает ответ
+// ErrorResponder-ом (без него - текстом "Forbidden")
+func (p *PermissionsChecker) echoForbidden(c echo.Context, decision Decision) error {
+	authErr := p.forbiddenError(c.Response(), c.Request(), decision)
+	if p.echoHTTPErrors {
+		return authErr.echoHTTPError()
+	}
+	responder := p.responder(c.Request())
+	if responder == nil {
+		return c.String(http.StatusForbidden, authErr.Message)
+	}
+
+	responder(c.Response(), c.Request(), authErr)
+	return nil
+}
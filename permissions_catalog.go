@@ -0,0 +1,84 @@
+package iam_client
+
+import (
+	"sort"
+	"strings"
+)
+
+// recordRequire запоминает требование Require для каталога прав
+func (p *PermissionsChecker) recordRequire(require *routeRequirement) {
+	p.requireMu.Lock()
+	defer p.requireMu.Unlock()
+	p.requirements = append(p.requirements, require.requirement)
+}
+
+// PermissionCatalog возвращает отсортированный список прав, которые понимает сервис: права из матрицы доступа,
+// вызовов Require (уже сделанных к моменту вызова) и глобальных правил. Выражения разбираются на отдельные права,
+// а скоуп с плейсхолдером обрезается: "edit:category:{id}" попадает в каталог как "edit:category".
+func (p *PermissionsChecker) PermissionCatalog() []string {
+	var permissions []string
+	add := func(req *requirement) {
+		for _, permission := range req.permissions() {
+			permissions = append(permissions, catalogPermission(permission))
+		}
+	}
+
+	snapshot := p.snapshot()
+	for _, route := range snapshot.byPath {
+		for _, rule := range route.allRules() {
+			if rule.requirement != nil {
+				add(rule.requirement)
+			}
+		}
+	}
+
+	p.requireMu.Lock()
+	for _, req := range p.requirements {
+		add(req)
+	}
+	p.requireMu.Unlock()
+
+	for _, rule := range p.globalRules {
+		permissions = append(permissions, rule.Permission)
+	}
+
+	sort.Strings(permissions)
+	return compactStrings(permissions)
+}
+
+// catalogPermission обрезает право по первому плейсхолдеру параметра пути
+func catalogPermission(permission string) string {
+	segments := strings.Split(permission, ":")
+	for i, segment := range segments {
+		if _, isPlaceholder := placeholderName(segment); isPlaceholder {
+			return strings.Join(segments[:i], ":")
+		}
+	}
+
+	return permission
+}
+
+// RegisterPermissions отправляет в IAM каталог прав сервиса, чтобы админка IAM предлагала права из него,
+// а не набранные по памяти. В каталог попадает PermissionCatalog() проверщика p (может быть nil) и права из
+// descriptions - описания для админки. Права, которые проверяются только в ручках (HasPermission и т.п.),
+// нужно передать в descriptions, иначе IAM о них не узнает.
+// IAM заменяет каталог сервиса целиком, поэтому повторный вызов безопасен. Вызывать после регистрации
+// всех ручек с Require, обычно при старте сервиса.
+func (s *Service) RegisterPermissions(p *PermissionsChecker, descriptions map[string]string) error {
+	var names []string
+	if p != nil {
+		names = p.PermissionCatalog()
+	}
+	for name := range descriptions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	names = compactStrings(names)
+
+	permissions := make([]IAMPermission, 0, len(names))
+	for _, name := range names {
+		permissions = append(permissions, IAMPermission{Name: name, Description: descriptions[name]})
+	}
+
+	return s.iamClient.UpsertPermissions(permissions)
+}
@@ -0,0 +1,68 @@
+package iam_client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestPermissionsChecker_PermissionCatalog(t *testing.T) {
+	p := NewPermissionsChecker(map[string][]string{
+		"GET/api/v1/admin/actionLog":  {"view:log", "admin:log"},
+		"POST/api/v1/category/{id}":   {"edit:category:{id} & (approve:* | admin)"},
+		"DELETE/api/v1/category/{id}": {"edit:category"},
+	}, nopLogger{})
+	p.Require("edit:item:{id}:price")
+	p.EchoRequire("view:salary")
+
+	want := []string{"admin", "admin:*", "admin:log", "approve:*", "edit:category", "edit:item", "view:*", "view:log", "view:salary"}
+	if got := p.PermissionCatalog(); !reflect.DeepEqual(got, want) {
+		t.Errorf("PermissionCatalog() = %v, want %v", got, want)
+	}
+}
+
+func TestService_RegisterPermissions(t *testing.T) {
+	var got IAMUpsertPermissionsRequest
+	var gotClientId string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/upsertPermissions" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		gotClientId = r.Header.Get("X-Client-Id")
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		_ = json.NewEncoder(w).Encode(IAMResponseSuccess{Success: true})
+	}))
+	defer server.Close()
+
+	p := NewPermissionsChecker(map[string][]string{"GET/api/v1/admin/actionLog": {"view:log"}}, nopLogger{})
+	if err := p.WithGlobalRules(); err != nil {
+		t.Fatal(err)
+	}
+	s := New("some_service", Config{IamUrl: server.URL}, nopLogger{})
+	err := s.RegisterPermissions(p, map[string]string{
+		"view:log":    "Просмотр журнала действий",
+		"view:salary": "Просмотр зарплат в карточке сотрудника",
+	})
+	if err != nil {
+		t.Fatalf("RegisterPermissions() error = %s", err)
+	}
+
+	want := IAMUpsertPermissionsRequest{
+		ServiceId: "some_service",
+		Permissions: []IAMPermission{
+			{Name: "view:log", Description: "Просмотр журнала действий"},
+			{Name: "view:salary", Description: "Просмотр зарплат в карточке сотрудника"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) || gotClientId != "some_service" {
+		t.Errorf("IAM got %+v from %q, want %+v from %q", got, gotClientId, want, "some_service")
+	}
+
+	s = New("some_service", Config{IamUrl: server.URL + "/unknown"}, nopLogger{})
+	if err := s.RegisterPermissions(p, nil); err == nil {
+		t.Error("RegisterPermissions() with an IAM error returned no error")
+	}
+}
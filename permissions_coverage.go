@@ -0,0 +1,375 @@
+package iam_client
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/mux"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+)
+
+// Route ручка роутера для проверки покрытия матрицей доступа. Пустой Method или ANY - все методы
+type Route struct {
+	Method string
+	Path   string
+}
+
+func (r Route) String() string {
+	method := r.Method
+	if method == "" {
+		method = MethodAny
+	}
+
+	return method + r.Path
+}
+
+// CoverageReport результат сверки ручек роутера с матрицей доступа
+type CoverageReport struct {
+	// UncoveredRoutes ручки, для которых нет ни правила в матрице, ни Require. К ним пускают только глобальные правила
+	UncoveredRoutes []Route
+	// UnusedRules ключи матрицы, которым не соответствует ни одна ручка роутера
+	UnusedRules []string
+	// DuplicateRules ключи матрицы, описывающие одну и ту же ручку (например, с разными именами макросов)
+	DuplicateRules []string
+	// PublicRoutes публичные ручки (см. WithPublicRoutes), правила для них не нужны
+	PublicRoutes []Route
+}
+
+// OK возвращает true, если расхождений нет. Публичные ручки расхождением не считаются
+func (c CoverageReport) OK() bool {
+	return len(c.UncoveredRoutes) == 0 && len(c.UnusedRules) == 0 && len(c.DuplicateRules) == 0
+}
+
+func (c CoverageReport) Error() string {
+	var messages []string
+	for _, route := range c.UncoveredRoutes {
+		messages = append(messages, "route without rule "+route.String())
+	}
+	for _, key := range c.UnusedRules {
+		messages = append(messages, "rule without route "+key)
+	}
+	messages = append(messages, c.DuplicateRules...)
+
+	return "permissions matrix coverage: " + strings.Join(messages, "; ")
+}
+
+// Validate сверяет ручки роутера с текущей матрицей доступа. router - *mux.Router, *chi.Mux, *echo.Echo,
+// []*echo.Route (результат e.Routes()), []Route или *OpenAPIPermissions (операции спецификации OpenAPI).
+// Ручки echo ":id" и "*" приводятся к {id} и "**". Ручки gorilla/mux и chi, защищенные Require, считаются покрытыми.
+// Ручки echo с EchoRequire считаются покрытыми, только если роутер echo подключен через WithEchoRouter
+// до регистрации ручек: echo не отдает middleware ручки после регистрации.
+//
+// Расхождения пишутся в лог. В строгом режиме (strict) при расхождениях возвращается ошибка с отчетом,
+// ее удобно использовать, чтобы не дать сервису стартовать с неполной матрицей.
+func (p *PermissionsChecker) Validate(router any, strict bool) (CoverageReport, error) {
+	routes, required, err := p.collectRoutes(router)
+	if err != nil {
+		return CoverageReport{}, err
+	}
+
+	report := p.coverage(routes, required)
+	if report.OK() {
+		return report, nil
+	}
+	if strict {
+		return report, report
+	}
+	if p.log != nil {
+		p.log.Warningf("Uc3cMWIIfoaGEtq %s", report.Error())
+	}
+
+	return report, nil
+}
+
+func (p *PermissionsChecker) coverage(routes []Route, required map[Route]bool) CoverageReport {
+	snapshot := p.snapshot()
+
+	var report CoverageReport
+	used := make(map[string]bool)
+	// Маршруты матрицы по пути без имен макросов: "/category/{id}" и "/category/{categoryId}" - одна ручка
+	byPattern := make(map[string][]*matrixRoute)
+	for path, route := range snapshot.byPath {
+		pattern := routePattern(path)
+		byPattern[pattern] = append(byPattern[pattern], route)
+	}
+
+	for _, route := range routes {
+		if p.publicRoutes.match(route.Method, route.Path) {
+			report.PublicRoutes = append(report.PublicRoutes, route)
+			continue
+		}
+
+		rules := p.coveringRules(snapshot, byPattern, route)
+		for _, rule := range rules {
+			used[rule.key] = true
+		}
+		if len(rules) == 0 && !required[route] && !p.isEchoRequireRoute(route) {
+			report.UncoveredRoutes = append(report.UncoveredRoutes, route)
+		}
+	}
+
+	for path, route := range snapshot.byPath {
+		for _, rule := range route.allRules() {
+			if !used[rule.key] {
+				report.UnusedRules = append(report.UnusedRules, rule.key)
+			}
+		}
+		for _, other := range byPattern[routePattern(path)] {
+			if other != route {
+				report.DuplicateRules = append(report.DuplicateRules, route.duplicates(other)...)
+			}
+		}
+	}
+
+	sort.Slice(report.UncoveredRoutes, func(i, j int) bool {
+		return report.UncoveredRoutes[i].String() < report.UncoveredRoutes[j].String()
+	})
+	sort.Slice(report.PublicRoutes, func(i, j int) bool {
+		return report.PublicRoutes[i].String() < report.PublicRoutes[j].String()
+	})
+	sort.Strings(report.UnusedRules)
+	sort.Strings(report.DuplicateRules)
+	report.DuplicateRules = compactStrings(report.DuplicateRules)
+
+	return report
+}
+
+// coveringRules возвращает правила матрицы, которые применяются к ручке роутера
+func (p *PermissionsChecker) coveringRules(snapshot *matrixSnapshot, byPattern map[string][]*matrixRoute, route Route) []*matrixRule {
+	methods := []string{route.Method}
+	if route.Method == "" || route.Method == MethodAny {
+		methods = matrixMethods
+	}
+
+	var rules []*matrixRule
+	for _, method := range methods {
+		var rule *matrixRule
+		for _, candidate := range byPattern[routePattern(route.Path)] {
+			if rule = candidate.rule(method, p.optionsPolicy); rule != nil {
+				break
+			}
+		}
+		if rule == nil {
+			// Шаблон ручки может покрываться более общим путем матрицы, например, "/api/**"
+			if candidate, _, _, found := snapshot.routes.match(route.Path, func(candidate *matrixRoute) bool {
+				return candidate.rule(method, p.optionsPolicy) != nil
+			}); found {
+				rule = candidate.rule(method, p.optionsPolicy)
+			}
+		}
+		if rule != nil {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules
+}
+
+// collectRoutes собирает ручки роутера. required - ручки, обернутые Require
+func (p *PermissionsChecker) collectRoutes(router any) (routes []Route, required map[Route]bool, err error) {
+	required = make(map[Route]bool)
+	switch router := router.(type) {
+	case *mux.Router:
+		err = router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+			if route.GetHandler() == nil {
+				// Префикс саброутера, сам по себе не ручка
+				return nil
+			}
+			path, err := route.GetPathTemplate()
+			if err != nil {
+				return nil
+			}
+			handler, isRequire := route.GetHandler().(*requireHandler)
+			isRequire = isRequire && handler.p == p
+
+			methods, err := route.GetMethods()
+			if err != nil {
+				methods = []string{MethodAny}
+			}
+			for _, method := range methods {
+				r := Route{Method: method, Path: path}
+				routes = append(routes, r)
+				required[r] = isRequire
+			}
+			return nil
+		})
+
+	case *chi.Mux:
+		err = chi.Walk(router, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+			r := Route{Method: method, Path: chiRoutePath(route)}
+			routes = append(routes, r)
+			required[r] = p.isChiRequire(handler, middlewares)
+			return nil
+		})
+
+	case *echo.Echo:
+		routes = echoRoutes(router.Routes())
+
+	case []*echo.Route:
+		routes = echoRoutes(router)
+
+	case []Route:
+		routes = router
+
+	case *OpenAPIPermissions:
+		routes = router.Operations
+
+	default:
+		err = errors.Errorf("unsupported router %T", router)
+	}
+
+	return routes, required, errors.Wrap(err, "walk router")
+}
+
+// isChiRequire проверяет, что ручка chi защищена Require: либо обработчик обернут им напрямую
+// (r.Method("POST", path, checker.Require(...)(handler))), либо Require подключен через r.With или r.Use.
+// Middleware ищется по идентификатору (см. funcId), сами middleware не вызываются
+func (p *PermissionsChecker) isChiRequire(handler http.Handler, middlewares []func(http.Handler) http.Handler) bool {
+	if handler, isRequire := handler.(*requireHandler); isRequire && handler.p == p {
+		return true
+	}
+	for _, middleware := range middlewares {
+		if p.isRequireMiddleware(funcId(middleware)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func chiRoutePath(route string) string {
+	if strings.HasSuffix(route, "/*") {
+		return strings.TrimSuffix(route, "*") + "**"
+	}
+
+	return route
+}
+
+func echoRoutes(echoRoutes []*echo.Route) []Route {
+	routes := make([]Route, 0, len(echoRoutes))
+	for _, route := range echoRoutes {
+		if !InArray(matrixMethods, route.Method) {
+			// Служебные ручки echo, например, echo.RouteNotFound
+			continue
+		}
+
+		segments := splitPath(route.Path)
+		for i, segment := range segments {
+			switch {
+			case strings.HasPrefix(segment, ":"):
+				segments[i] = "{" + segment[1:] + "}"
+			case segment == "*":
+				segments[i] = "**"
+			}
+		}
+		routes = append(routes, Route{Method: route.Method, Path: "/" + strings.Join(segments, "/")})
+	}
+
+	return routes
+}
+
+// routePattern убирает из пути имена макросов, оставляя регулярки: "/c/{id}/{n:[0-9]+}" => "/c/{}/{:[0-9]+}"
+func routePattern(path string) string {
+	segments := splitPath(path)
+	for i, segment := range segments {
+		if !strings.Contains(segment, "{") {
+			continue
+		}
+
+		var pattern strings.Builder
+		for segment != "" {
+			start := strings.IndexByte(segment, '{')
+			if start < 0 {
+				pattern.WriteString(segment)
+				break
+			}
+			pattern.WriteString(segment[:start+1])
+			segment = segment[start+1:]
+
+			// Пропускаем имя макроса, регулярка может содержать свои фигурные скобки
+			depth, end := 1, len(segment)
+			for j := 0; j < len(segment); j++ {
+				if segment[j] == '{' {
+					depth++
+				} else if segment[j] == '}' {
+					depth--
+					if depth == 0 {
+						end = j
+						break
+					}
+				}
+			}
+			if colon := strings.IndexByte(segment[:end], ':'); colon >= 0 {
+				pattern.WriteString(segment[colon:end])
+			}
+			pattern.WriteByte('}')
+			if end < len(segment) {
+				end++
+			}
+			segment = segment[end:]
+		}
+		segments[i] = pattern.String()
+	}
+
+	return "/" + strings.Join(segments, "/")
+}
+
+// allRules возвращает все правила маршрута матрицы без повторов
+func (route *matrixRoute) allRules() []*matrixRule {
+	var rules []*matrixRule
+	seen := make(map[*matrixRule]bool)
+	add := func(rule *matrixRule) {
+		if rule != nil && !seen[rule] {
+			seen[rule] = true
+			rules = append(rules, rule)
+		}
+	}
+	for _, method := range matrixMethods {
+		add(route.methods[method])
+		add(route.lists[method])
+	}
+	add(route.any)
+
+	return rules
+}
+
+// duplicates описывает правила route, которые дублируют правила other на той же ручке
+func (route *matrixRoute) duplicates(other *matrixRoute) []string {
+	var messages []string
+	for _, method := range matrixMethods {
+		if rule, otherRule := route.methods[method], other.methods[method]; rule != nil && otherRule != nil {
+			messages = append(messages, duplicateMessage(rule.key, otherRule.key))
+		}
+		if rule, otherRule := route.lists[method], other.lists[method]; rule != nil && otherRule != nil {
+			messages = append(messages, duplicateMessage(rule.key, otherRule.key))
+		}
+	}
+	if route.any != nil && other.any != nil {
+		messages = append(messages, duplicateMessage(route.any.key, other.any.key))
+	}
+
+	return messages
+}
+
+func duplicateMessage(key, otherKey string) string {
+	if otherKey < key {
+		key, otherKey = otherKey, key
+	}
+
+	return fmt.Sprintf("duplicate rules %s and %s", key, otherKey)
+}
+
+func compactStrings(sorted []string) []string {
+	var result []string
+	for i, s := range sorted {
+		if i == 0 || s != sorted[i-1] {
+			result = append(result, s)
+		}
+	}
+
+	return result
+}
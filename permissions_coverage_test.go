@@ -0,0 +1,178 @@
+package iam_client
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/mux"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+func TestPermissionsChecker_Validate(t *testing.T) {
+	permissionsMatrix := map[string][]string{
+		"GET/api/v1/category/{id}":          {"view:category"},
+		"POST/api/v1/category/{categoryId}": {"edit:category"},
+		"PUT/api/v1/category/{id}":          {"edit:category"},
+		"PUT/api/v1/category/{categoryId}":  {"admin"},
+		"GET/api/v1/static/**":              {"view"},
+		"GET/api/v1/categroy":               {"view:category"},
+	}
+
+	noop := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+
+	gorillaRouter := mux.NewRouter()
+	gorillaRouter.Handle("/api/v1/category/{id}", noop).Methods(http.MethodGet, http.MethodPost, http.MethodPut)
+	gorillaRouter.Handle("/api/v1/category/{id}", noop).Methods(http.MethodDelete)
+	gorillaRouter.Handle("/api/v1/static/js/{file}", noop).Methods(http.MethodGet)
+	gorillaRouter.Handle("/api/v1/category", noop).Methods(http.MethodGet)
+
+	chiRouter := chi.NewRouter()
+	chiRouter.Method(http.MethodGet, "/api/v1/category/{id}", noop)
+	chiRouter.Method(http.MethodPost, "/api/v1/category/{id}", noop)
+	chiRouter.Method(http.MethodPut, "/api/v1/category/{id}", noop)
+	chiRouter.Method(http.MethodDelete, "/api/v1/category/{id}", noop)
+	chiRouter.Method(http.MethodGet, "/api/v1/static/js/{file}", noop)
+	chiRouter.Method(http.MethodGet, "/api/v1/category", noop)
+
+	e := echo.New()
+	echoHandler := func(echo.Context) error { return nil }
+	e.GET("/api/v1/category/:id", echoHandler)
+	e.POST("/api/v1/category/:id", echoHandler)
+	e.PUT("/api/v1/category/:id", echoHandler)
+	e.DELETE("/api/v1/category/:id", echoHandler)
+	e.GET("/api/v1/static/*", echoHandler)
+	e.GET("/api/v1/category", echoHandler)
+
+	want := CoverageReport{
+		UncoveredRoutes: []Route{
+			{Method: http.MethodDelete, Path: "/api/v1/category/{id}"},
+			{Method: http.MethodGet, Path: "/api/v1/category"},
+		},
+		UnusedRules:    []string{"GET/api/v1/categroy"},
+		DuplicateRules: []string{"duplicate rules PUT/api/v1/category/{categoryId} and PUT/api/v1/category/{id}"},
+	}
+
+	routers := map[string]any{
+		"gorilla/mux": gorillaRouter,
+		"chi":         chiRouter,
+		"echo":        e,
+	}
+	for name, router := range routers {
+		t.Run(name, func(t *testing.T) {
+			p := NewPermissionsChecker(permissionsMatrix, nopLogger{})
+			got, err := p.Validate(router, false)
+			if err != nil {
+				t.Fatalf("Validate() error = %s", err)
+			}
+			// Один из дублей PUT не используется, какой именно - зависит от обхода map
+			got.UnusedRules = removeString(got.UnusedRules, "PUT/api/v1/category/{categoryId}")
+			got.UnusedRules = removeString(got.UnusedRules, "PUT/api/v1/category/{id}")
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Validate() = %+v, want %+v", got, want)
+			}
+
+			if _, err := p.Validate(router, true); err == nil {
+				t.Error("Validate() in strict mode returned no error")
+			}
+		})
+	}
+}
+
+func TestPermissionsChecker_ValidateRequire(t *testing.T) {
+	p := NewPermissionsChecker(nil, nopLogger{})
+	noop := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+
+	router := mux.NewRouter()
+	router.Handle("/api/v1/category/{id}", p.Require("edit:category:{id}")(noop)).Methods(http.MethodPost)
+
+	report, err := p.Validate(router, true)
+	if err != nil || !report.OK() {
+		t.Errorf("Validate() = %+v, %v, want a route covered by Require", report, err)
+	}
+}
+
+func Test_routePattern(t *testing.T) {
+	tests := map[string]string{
+		"/api/v1/category":                 "/api/v1/category",
+		"/api/v1/category/{id}":            "/api/v1/category/{}",
+		"/api/v1/category/{id:[0-9]{3}}":   "/api/v1/category/{:[0-9]{3}}",
+		"/api/v1/files/{name}.{ext}":       "/api/v1/files/{}.{}",
+		"/api/v1/category/{id}/items/{n}/": "/api/v1/category/{}/items/{}/",
+	}
+	for path, want := range tests {
+		if got := routePattern(path); got != want {
+			t.Errorf("routePattern(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func removeString(list []string, s string) []string {
+	var result []string
+	for _, item := range list {
+		if item != s {
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
+
+func TestPermissionsChecker_ValidateRequireChiEcho(t *testing.T) {
+	noop := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	echoHandler := func(echo.Context) error { return nil }
+	want := []Route{{Method: http.MethodGet, Path: "/api/v1/category/{id}"}}
+
+	t.Run("chi", func(t *testing.T) {
+		p := NewPermissionsChecker(nil, nopLogger{})
+		router := chi.NewRouter()
+		var calls int
+		counting := func(next http.Handler) http.Handler {
+			calls++
+			return next
+		}
+		router.With(p.Require("edit:category:{id}")).Post("/api/v1/category/{id}", noop)
+		router.With(p.Require("edit:category:{id}"), counting).Delete("/api/v1/category/{id}", noop)
+		router.Method(http.MethodPut, "/api/v1/category/{id}", p.Require("edit:category:{id}")(noop))
+		router.With(counting).Get("/api/v1/category/{id}", noop)
+		registered := calls
+
+		report, err := p.Validate(router, false)
+		if err != nil || !reflect.DeepEqual(report.UncoveredRoutes, want) {
+			t.Errorf("Validate() = %+v, %v, want uncovered %v", report, err, want)
+		}
+		if calls != registered {
+			t.Errorf("Validate() called route middlewares %d times", calls-registered)
+		}
+
+		// Require другого проверщика ручку этого не покрывает
+		other := NewPermissionsChecker(nil, nopLogger{})
+		report, err = other.Validate(router, false)
+		if err != nil || len(report.UncoveredRoutes) != 4 {
+			t.Errorf("Validate() of another checker = %+v, %v, want 4 uncovered routes", report, err)
+		}
+	})
+
+	t.Run("echo", func(t *testing.T) {
+		p := NewPermissionsChecker(nil, nopLogger{})
+		e := echo.New()
+		var addedRoutes int
+		e.OnAddRouteHandler = func(string, echo.Route, echo.HandlerFunc, []echo.MiddlewareFunc) { addedRoutes++ }
+		p.WithEchoRouter(e)
+		e.POST("/api/v1/category/:id", echoHandler, p.EchoRequire("edit:category:{id}"))
+		e.DELETE("/api/v1/category/:id", echoHandler, p.EchoRequire("edit:category:{id}"), middleware.RequestID())
+		e.Group("/api/v1", p.EchoRequire("edit:category")).PUT("/category/:id", echoHandler)
+		e.GET("/api/v1/category/:id", echoHandler, p.EchoAuthMiddlewareHandler())
+
+		report, err := p.Validate(e, false)
+		if err != nil || !reflect.DeepEqual(report.UncoveredRoutes, want) {
+			t.Errorf("Validate() = %+v, %v, want uncovered %v", report, err, want)
+		}
+		// Group дополнительно регистрирует служебные ручки RouteNotFound
+		if addedRoutes < 4 {
+			t.Errorf("previous OnAddRouteHandler called %d times, want at least 4", addedRoutes)
+		}
+	})
+}
@@ -0,0 +1,226 @@
+package iam_client
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// MatchSource способ, которым для запроса найдено правило
+type MatchSource string
+
+const (
+	// MatchNone правило не найдено
+	MatchNone MatchSource = ""
+	// MatchExact точное совпадение пути запроса с ключом матрицы
+	MatchExact MatchSource = "exact"
+	// MatchGorilla шаблон пути из gorilla/mux, см. WithGorillaMuxRouter
+	MatchGorilla MatchSource = "gorilla"
+	// MatchChi шаблон пути из chi, см. WithChiMuxRouter
+	MatchChi MatchSource = "chi"
+	// MatchBuiltin встроенный матчер путей с макросами
+	MatchBuiltin MatchSource = "builtin"
+	// MatchRequire правила в матрице нет, права заданы на ручке через Require
+	MatchRequire MatchSource = "require"
+	// MatchGlobal глобальное правило, см. WithGlobalRules
+	MatchGlobal MatchSource = "global"
+	// MatchOptions запрос OPTIONS при политике OptionsAllow
+	MatchOptions MatchSource = "options"
+	// MatchPublic публичная ручка, см. WithPublicRoutes
+	MatchPublic MatchSource = "public"
+)
+
+// Decision объяснение решения о доступе к ручке
+type Decision struct {
+	// Allowed итоговое решение
+	Allowed bool
+	// Reason причина отказа, пустая при Allowed
+	Reason AuthErrorReason
+	// Source как найдено правило. Если на ручке есть и правило матрицы, и Require, - как найдено правило матрицы
+	Source MatchSource
+	// Key ключ матрицы доступа, если правило найдено в матрице
+	Key string
+	// GlobalRule право глобального правила, которое пустило пользователя
+	GlobalRule string
+	// Required разрешенные права из матрицы доступа
+	Required []string
+	// RouteRequired права, заданные на ручке через Require
+	RouteRequired []string
+	// GrantedBy права пользователя, которые дали доступ
+	GrantedBy []string
+	// Missing права, которых не хватило для доступа, с подставленными параметрами пути
+	Missing []string
+	// Shadowed отказ не применен из-за режима EnforcementShadow: Allowed выставлен в true,
+	// а Reason и Missing описывают отказ, см. WithEnforcementMode
+	Shadowed bool
+}
+
+// String возвращает решение в одну строку, например,
+// "deny reason=forbidden source=gorilla key=POST/api/v1/category/{id} required=edit:category:{id}"
+func (d Decision) String() string {
+	var b strings.Builder
+	switch {
+	case d.Shadowed:
+		b.WriteString("shadow-deny reason=")
+		b.WriteString(string(d.Reason))
+	case d.Allowed:
+		b.WriteString("allow")
+	default:
+		b.WriteString("deny reason=")
+		b.WriteString(string(d.Reason))
+	}
+
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, " %s=%s", name, value)
+		}
+	}
+	field("source", string(d.Source))
+	field("key", d.Key)
+	field("global", d.GlobalRule)
+	field("required", strings.Join(d.Required, ","))
+	field("route_required", strings.Join(d.RouteRequired, ","))
+	field("granted_by", strings.Join(d.GrantedBy, ","))
+	field("missing", strings.Join(d.Missing, ","))
+
+	return b.String()
+}
+
+// passedThrough возвращает true, если запрос пропущен без проверки прав пользователя
+func (d Decision) passedThrough() bool {
+	return d.Source == MatchPublic || d.Source == MatchOptions
+}
+
+// DecisionDebug режим отладки решений о доступе, флаги можно комбинировать
+type DecisionDebug int
+
+const (
+	// DecisionDebugLog писать каждое решение в лог с уровнем Debug
+	DecisionDebugLog DecisionDebug = 1 << iota
+	// DecisionDebugHeader отдавать решение в заголовке ответа DecisionHeader
+	DecisionDebugHeader
+)
+
+// DecisionHeader заголовок ответа с решением о доступе при DecisionDebugHeader
+const DecisionHeader = "X-Iam-Decision"
+
+// WithDecisionDebug включает отладку решений о доступе. Заголовок раскрывает матрицу доступа клиенту,
+// поэтому DecisionDebugHeader не стоит включать в проде.
+func (p *PermissionsChecker) WithDecisionDebug(debug DecisionDebug) {
+	p.decisionDebug = debug
+}
+
+// Explain объясняет, пустит ли AuthMiddlewareHandler (или Require на ручке gorilla/mux) запрос r
+// пользователя с правами userPermissions. Запрос никуда не передается, лог не пишется, хук WithShadowHook
+// не вызывается. Отказ на ручке в режиме EnforcementShadow возвращается с Shadowed.
+func (p *PermissionsChecker) Explain(r *http.Request, userPermissions []string) Decision {
+	// Middleware раскрывают роли в expandRoles, здесь права передаются как есть
+	userPermissions = p.roles.Expand(userPermissions)
+
+	var decision Decision
+	if handler, params := p.routeRequireHandler(r); handler != nil {
+		decision = p.decide(r, userPermissions, handler.routeRequirement, params, true)
+	} else {
+		decision = p.decide(r, userPermissions, nil, nil, true)
+	}
+	p.shadowed(&decision)
+
+	return decision
+}
+
+// decide принимает решение о доступе. require - права, заданные на ручке через Require, или nil:
+// с ними правило матрицы необязательно, но если оно есть, должно выполняться вместе с require.
+// Права пользователя, давшие доступ (GrantedBy), собираются только при explain, а недостающие права (Missing) -
+// при отказе, если они нужны: explain, WithForbiddenDetails или режим EnforcementShadow ручки, см. needMissing.
+// Без этого decide на горячем пути не выделяет память.
+func (p *PermissionsChecker) decide(r *http.Request, userPermissions []string, require *routeRequirement, requireParams []pathParam, explain bool) Decision {
+	if p.publicRoutes.Match(r) {
+		return Decision{Allowed: true, Source: MatchPublic}
+	}
+	if r.Method == http.MethodOptions && p.optionsPolicy == OptionsAllow {
+		return Decision{Allowed: true, Source: MatchOptions}
+	}
+	if len(userPermissions) == 0 {
+		return Decision{Reason: ReasonEmptyPermissions}
+	}
+
+	// Индекс общий на все проверки запроса. Глобальные правила проверяются до матрицы и индекс не строят
+	index := newPermissionIndex(userPermissions)
+	var granted *[]string
+	decision := Decision{Reason: ReasonForbidden}
+	if explain {
+		granted = &decision.GrantedBy
+	}
+
+	// Глобальные правила (по умолчанию "admin:*" и "view:*") пропускают без матрицы
+	if permission, found := p.matchGlobalRule(r, &index); found {
+		decision = Decision{Allowed: true, Source: MatchGlobal, GlobalRule: permission}
+		if explain {
+			decision.GrantedBy = []string{permission}
+		}
+		return decision
+	}
+
+	rule, params, source := p.findRule(r)
+	if rule != nil {
+		decision.Source, decision.Key, decision.Required = source, rule.key, rule.permissions
+		if !rule.allows(&index, params, granted) {
+			decision.GrantedBy = nil
+			if rule.requirement != nil && p.needMissing(explain, decision.Key) {
+				rule.requirement.missing(&index, params, &decision.Missing)
+			}
+			return decision
+		}
+	}
+
+	if require != nil {
+		if rule == nil {
+			decision.Source = MatchRequire
+		}
+		decision.RouteRequired = require.permissions
+		if !require.requirement.evalGranted(&index, requireParams, granted) {
+			decision.GrantedBy = nil
+			if p.needMissing(explain, decision.Key) {
+				require.requirement.missing(&index, requireParams, &decision.Missing)
+			}
+			return decision
+		}
+	} else if rule == nil {
+		// Ручки без правила доступны только по глобальным правилам
+		return decision
+	}
+
+	decision.Allowed, decision.Reason = true, ""
+	if explain {
+		decision.GrantedBy = compactPermissions(decision.GrantedBy)
+	}
+
+	return decision
+}
+
+// needMissing нужны ли недостающие права при отказе на ручке key: для Explain, для 403 с деталями
+// и для отчета о непримененном отказе в режиме EnforcementShadow
+func (p *PermissionsChecker) needMissing(explain bool, key string) bool {
+	return explain || p.forbiddenDetails || p.enforcement(key) == EnforcementShadow
+}
+
+// debugDecision пишет решение в лог и/или заголовок ответа, если включена отладка
+func (p *PermissionsChecker) debugDecision(w http.ResponseWriter, r *http.Request, decision Decision) {
+	if p.decisionDebug&DecisionDebugLog != 0 {
+		p.log.Debugf("permissions decision %s %s: %s", r.Method, r.URL.Path, decision)
+	}
+	if p.decisionDebug&DecisionDebugHeader != 0 {
+		w.Header().Set(DecisionHeader, decision.String())
+	}
+}
+
+func compactPermissions(permissions []string) []string {
+	var result []string
+	for _, permission := range permissions {
+		if !InArray(result, permission) {
+			result = append(result, permission)
+		}
+	}
+
+	return result
+}
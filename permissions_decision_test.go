@@ -0,0 +1,140 @@
+package iam_client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestPermissionsChecker_Explain(t *testing.T) {
+	permissionsMatrix := map[string][]string{
+		"GET/api/v1/admin/actionLog":  {"view:log", "admin:log"},
+		"POST/api/v1/category/{id}":   {"edit:category:{id} & approve"},
+		"DELETE/api/v1/category/{id}": {"admin"},
+	}
+
+	noop := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	router := mux.NewRouter()
+	router.Handle("/api/v1/admin/actionLog", noop).Methods(http.MethodGet)
+	router.Handle("/api/v1/category/{id}", noop).Methods(http.MethodPost, http.MethodDelete)
+	router.Handle("/api/v1/items/{id}", NewPermissionsChecker(nil, nil).Require("edit:item:{id}")(noop)).Methods(http.MethodPut)
+
+	tests := []struct {
+		name            string
+		method          string
+		path            string
+		userPermissions []string
+		want            Decision
+	}{
+		{
+			name:            "Empty permissions",
+			method:          http.MethodGet,
+			path:            "/api/v1/admin/actionLog",
+			userPermissions: nil,
+			want:            Decision{Reason: ReasonEmptyPermissions},
+		},
+
+		{
+			name:            "Global rule",
+			method:          http.MethodGet,
+			path:            "/api/v1/admin/actionLog",
+			userPermissions: []string{"view:*"},
+			want:            Decision{Allowed: true, Source: MatchGlobal, GlobalRule: "view:*", GrantedBy: []string{"view:*"}},
+		},
+
+		{
+			name:            "Exact path",
+			method:          http.MethodGet,
+			path:            "/api/v1/admin/actionLog",
+			userPermissions: []string{"edit:category", "admin:log"},
+			want: Decision{
+				Allowed:   true,
+				Source:    MatchExact,
+				Key:       "GET/api/v1/admin/actionLog",
+				Required:  []string{"view:log", "admin:log"},
+				GrantedBy: []string{"admin:log"},
+			},
+		},
+
+		{
+			name:            "Gorilla template, scope mismatch",
+			method:          http.MethodPost,
+			path:            "/api/v1/category/43",
+			userPermissions: []string{"edit:category:42", "approve:category"},
+			want: Decision{
+				Reason:   ReasonForbidden,
+				Source:   MatchGorilla,
+				Key:      "POST/api/v1/category/{id}",
+				Required: []string{"edit:category:{id} & approve"},
+				Missing:  []string{"edit:category:43"},
+			},
+		},
+
+		{
+			name:            "Gorilla template, all permissions of an AND",
+			method:          http.MethodPost,
+			path:            "/api/v1/category/42",
+			userPermissions: []string{"edit:category:42", "approve:category"},
+			want: Decision{
+				Allowed:   true,
+				Source:    MatchGorilla,
+				Key:       "POST/api/v1/category/{id}",
+				Required:  []string{"edit:category:{id} & approve"},
+				GrantedBy: []string{"edit:category:42", "approve:category"},
+			},
+		},
+
+		{
+			name:            "No matrix entry",
+			method:          http.MethodPut,
+			path:            "/api/v1/category/42",
+			userPermissions: []string{"edit:category:42"},
+			want:            Decision{Reason: ReasonForbidden},
+		},
+
+		{
+			name:            "Route with Require",
+			method:          http.MethodPut,
+			path:            "/api/v1/items/7",
+			userPermissions: []string{"edit:item:7"},
+			want: Decision{
+				Allowed:       true,
+				Source:        MatchRequire,
+				RouteRequired: []string{"edit:item:{id}"},
+				GrantedBy:     []string{"edit:item:7"},
+			},
+		},
+	}
+	p := NewPermissionsChecker(permissionsMatrix, nopLogger{})
+	p.WithGorillaMuxRouter(router)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			if got := p.Explain(r, tt.userPermissions); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Explain() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPermissionsChecker_WithDecisionDebug(t *testing.T) {
+	p := NewPermissionsChecker(map[string][]string{
+		"GET/api/v1/category/{id}": {"view:category"},
+	}, nopLogger{})
+	p.WithDecisionDebug(DecisionDebugHeader | DecisionDebugLog)
+	handler := p.AuthMiddlewareHandler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/category/1", nil)
+	r = r.WithContext(context.WithValue(r.Context(), CtxIamPermissions{}, []string{"edit:category"}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	want := "deny reason=forbidden source=builtin key=GET/api/v1/category/{id} required=view:category missing=view:category"
+	if w.Code != http.StatusForbidden || w.Header().Get(DecisionHeader) != want {
+		t.Errorf("status = %v, %s = %q, want %v, %q", w.Code, DecisionHeader, w.Header().Get(DecisionHeader), http.StatusForbidden, want)
+	}
+}
@@ -0,0 +1,373 @@
+package iam_client
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Файл матрицы доступа (YAML или JSON) имеет вид:
+//
+//	rules:
+//	  - method: GET
+//	    path: /api/v1/admin/actionLog
+//	    permissions: [view:log, admin:log]
+//	  - method: POST
+//	    path: /api/v1/admin/category/{id}
+//	    permissions: [edit:category]
+//	  - method: POST
+//	    path: /api/v1/admin/category/{id}/approve
+//	    permissions: ["edit:category & (approve:* | admin)"]
+//	  - method: DELETE
+//	    path: /api/v1/admin/category/{id}
+//	    permissions: ["edit:category:{id}"]
+//
+// Каждое правило превращается в элемент матрицы "METHOD/path" => permissions, см. NewPermissionsChecker.
+// Вместо одного метода можно указать ANY или список методов: "GET|HEAD" либо [GET, HEAD].
+
+// NewPermissionsCheckerFromFile читает матрицу доступа из YAML или JSON файла и возвращает готовый PermissionsChecker
+func NewPermissionsCheckerFromFile(path string, log Logger) (*PermissionsChecker, error) {
+	permissionsMatrix, err := LoadPermissionsMatrix(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPermissionsChecker(permissionsMatrix, log), nil
+}
+
+// LoadPermissionsMatrix читает матрицу доступа из YAML или JSON файла.
+// Ошибки валидации возвращаются в виде MatrixErrors с номерами строк.
+func LoadPermissionsMatrix(path string) (map[string][]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read permissions matrix")
+	}
+
+	permissionsMatrix, err := ParsePermissionsMatrix(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "permissions matrix %s", path)
+	}
+
+	return permissionsMatrix, nil
+}
+
+// ParsePermissionsMatrix разбирает и валидирует матрицу доступа в формате YAML или JSON
+func ParsePermissionsMatrix(data []byte) (map[string][]string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	var errs MatrixErrors
+	permissionsMatrix := make(map[string][]string)
+	if len(doc.Content) == 0 {
+		return permissionsMatrix, nil
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, append(errs, MatrixError{Line: root.Line, Msg: "expected a mapping with the \"rules\" key"})
+	}
+
+	var rules *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		if key.Value != "rules" {
+			errs = append(errs, MatrixError{Line: key.Line, Msg: fmt.Sprintf("unknown key %q", key.Value)})
+			continue
+		}
+		rules = value
+	}
+	if rules == nil {
+		return permissionsMatrix, errs.orNil()
+	}
+	if rules.Kind != yaml.SequenceNode {
+		return nil, append(errs, MatrixError{Line: rules.Line, Msg: "\"rules\" must be a list"})
+	}
+
+	// Строки, на которых впервые объявлен ключ матрицы, для сообщений о дублях
+	keyLines := make(map[string]int)
+	// Строки, на которых метод пути впервые покрыт списком методов: один метод не может входить в два списка
+	listLines := make(map[string]int)
+	for _, ruleNode := range rules.Content {
+		rule, ruleErrs := parseMatrixRule(ruleNode)
+		errs = append(errs, ruleErrs...)
+		if len(ruleErrs) > 0 {
+			continue
+		}
+
+		key := rule.method + rule.path
+		if line, found := keyLines[key]; found {
+			errs = append(errs, MatrixError{Line: ruleNode.Line, Msg: fmt.Sprintf("duplicate rule %s, first defined at line %d", key, line)})
+			continue
+		}
+		if strings.Contains(rule.method, "|") {
+			for _, method := range strings.Split(rule.method, "|") {
+				if line, found := listLines[method+rule.path]; found {
+					errs = append(errs, MatrixError{Line: ruleNode.Line, Msg: fmt.Sprintf("method %s of %s is already covered by the rule at line %d", method, rule.path, line)})
+				}
+				listLines[method+rule.path] = ruleNode.Line
+			}
+		}
+		keyLines[key] = ruleNode.Line
+		permissionsMatrix[key] = rule.permissions
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return permissionsMatrix, nil
+}
+
+type matrixFileRule struct {
+	method      string
+	path        string
+	permissions []string
+}
+
+func parseMatrixRule(node *yaml.Node) (rule matrixFileRule, errs MatrixErrors) {
+	if node.Kind != yaml.MappingNode {
+		return rule, MatrixErrors{{Line: node.Line, Msg: "rule must be a mapping with method, path and permissions"}}
+	}
+
+	var hasMethod, hasPath, hasPermissions bool
+	var permissionNodes []*yaml.Node
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		switch key.Value {
+		case "method":
+			hasMethod = true
+			// Метод можно задать строкой ("GET", "GET|HEAD", "ANY") или списком ([GET, HEAD])
+			if value.Kind == yaml.SequenceNode {
+				methods := make([]string, 0, len(value.Content))
+				for _, methodNode := range value.Content {
+					methods = append(methods, methodNode.Value)
+				}
+				rule.method = canonicalMethods(strings.Join(methods, "|"))
+			} else {
+				rule.method = canonicalMethods(value.Value)
+			}
+			if err := validateMatrixMethod(rule.method); err != nil {
+				errs = append(errs, MatrixError{Line: value.Line, Msg: err.Error()})
+			}
+
+		case "path":
+			hasPath = true
+			rule.path = value.Value
+			if err := validateMatrixPath(rule.path); err != nil {
+				errs = append(errs, MatrixError{Line: value.Line, Msg: err.Error()})
+			}
+
+		case "permissions":
+			hasPermissions = true
+			if value.Kind != yaml.SequenceNode {
+				errs = append(errs, MatrixError{Line: value.Line, Msg: "permissions must be a list"})
+				continue
+			}
+			if len(value.Content) == 0 {
+				errs = append(errs, MatrixError{Line: value.Line, Msg: "permissions must not be empty"})
+				continue
+			}
+			for _, permissionNode := range value.Content {
+				if err := validateMatrixRequirement(permissionNode.Value); err != nil {
+					errs = append(errs, MatrixError{Line: permissionNode.Line, Msg: err.Error()})
+					continue
+				}
+				rule.permissions = append(rule.permissions, permissionNode.Value)
+				permissionNodes = append(permissionNodes, permissionNode)
+			}
+
+		default:
+			errs = append(errs, MatrixError{Line: key.Line, Msg: fmt.Sprintf("unknown rule field %q", key.Value)})
+		}
+	}
+
+	if !hasMethod {
+		errs = append(errs, MatrixError{Line: node.Line, Msg: "rule has no method"})
+	}
+	if !hasPath {
+		errs = append(errs, MatrixError{Line: node.Line, Msg: "rule has no path"})
+	}
+	if !hasPermissions {
+		errs = append(errs, MatrixError{Line: node.Line, Msg: "rule has no permissions"})
+	}
+	if hasPath && validateMatrixPath(rule.path) == nil {
+		for _, permissionNode := range permissionNodes {
+			if err := validateRequirementParams(permissionNode.Value, rule.path); err != nil {
+				errs = append(errs, MatrixError{Line: permissionNode.Line, Msg: err.Error()})
+			}
+		}
+	}
+
+	return rule, errs
+}
+
+var matrixMethods = []string{
+	"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "CONNECT", "TRACE",
+}
+
+// validateMatrixMethod проверяет метод ключа матрицы: один метод, список методов через "|" или ANY
+func validateMatrixMethod(method string) error {
+	if method == MethodAny {
+		return nil
+	}
+
+	methods := strings.Split(method, "|")
+	for i, m := range methods {
+		if !InArray(matrixMethods, m) {
+			return errors.Errorf("invalid HTTP method %q", m)
+		}
+		if InArray(methods[:i], m) {
+			return errors.Errorf("duplicate HTTP method %q", m)
+		}
+	}
+
+	return nil
+}
+
+// canonicalMethods приводит список методов к верхнему регистру и порядку matrixMethods,
+// чтобы "head|GET" и "GET|HEAD" давали один и тот же ключ матрицы
+func canonicalMethods(method string) string {
+	method = strings.ToUpper(method)
+	if method == MethodAny || !strings.Contains(method, "|") {
+		return method
+	}
+
+	methods := strings.Split(method, "|")
+	canonical := make([]string, 0, len(methods))
+	for _, m := range matrixMethods {
+		if InArray(methods, m) {
+			canonical = append(canonical, m)
+		}
+	}
+	if len(canonical) != len(methods) {
+		// Неизвестные методы и дубли оставляем как есть, их отловит validateMatrixMethod
+		return method
+	}
+
+	return strings.Join(canonical, "|")
+}
+
+var (
+	matrixParamNameRe  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	matrixPermissionRe = regexp.MustCompile(`^[A-Za-z0-9_.-]+(:([A-Za-z0-9_.-]+|\*|\{[A-Za-z_][A-Za-z0-9_]*\}))*$`)
+)
+
+// validateMatrixPath проверяет путь из матрицы: он должен начинаться с "/", не содержать пустых сегментов,
+// query и пробелов, макросы должны иметь вид {name} или {name:regexp}, а "**" может быть только последним сегментом
+func validateMatrixPath(path string) error {
+	if !strings.HasPrefix(path, "/") {
+		return errors.Errorf("path %q must start with \"/\"", path)
+	}
+	if strings.ContainsAny(path, " \t?#") {
+		return errors.Errorf("path %q must not contain spaces, query or fragment", path)
+	}
+
+	segments := strings.Split(strings.TrimSuffix(path[1:], "/"), "/")
+	for i, segment := range segments {
+		if segment == "" && path != "/" {
+			return errors.Errorf("path %q has an empty segment", path)
+		}
+		if segment == "**" && i != len(segments)-1 {
+			return errors.Errorf("path %q: \"**\" is allowed only at the end", path)
+		}
+		if err := validatePathSegmentMacros(segment); err != nil {
+			return errors.Wrapf(err, "path %q", path)
+		}
+	}
+
+	return nil
+}
+
+// validatePathSegmentMacros проверяет макросы {name} и {name:regexp} внутри сегмента пути
+func validatePathSegmentMacros(segment string) error {
+	for {
+		start := strings.IndexByte(segment, '{')
+		end := strings.IndexByte(segment, '}')
+		if start < 0 && end < 0 {
+			return nil
+		}
+		if start < 0 || end < start {
+			return errors.New("unbalanced braces")
+		}
+
+		// Регулярка может содержать свои фигурные скобки, например, {id:[0-9]{3}}
+		depth := 0
+		end = -1
+		for i := start; i < len(segment); i++ {
+			if segment[i] == '{' {
+				depth++
+			} else if segment[i] == '}' {
+				depth--
+				if depth == 0 {
+					end = i
+					break
+				}
+			}
+		}
+		if end < 0 {
+			return errors.New("unbalanced braces")
+		}
+
+		name, pattern, hasPattern := strings.Cut(segment[start+1:end], ":")
+		if !matrixParamNameRe.MatchString(name) {
+			return errors.Errorf("invalid macro name %q", name)
+		}
+		if hasPattern {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return errors.Errorf("invalid macro pattern %q", pattern)
+			}
+		}
+
+		segment = segment[end+1:]
+	}
+}
+
+// validateMatrixPermission проверяет синтаксис права "base[:scope...]", где любой уровень скоупа может быть "*"
+// или плейсхолдером параметра пути {name}
+func validateMatrixPermission(permission string) error {
+	if !matrixPermissionRe.MatchString(permission) {
+		return errors.Errorf("invalid permission %q, expected \"base[:scope...]\"", permission)
+	}
+
+	return nil
+}
+
+// MatrixError ошибка валидации матрицы доступа с номером строки в файле
+type MatrixError struct {
+	Line int
+	Msg  string
+}
+
+func (e MatrixError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+	}
+
+	return e.Msg
+}
+
+// MatrixErrors все ошибки валидации матрицы доступа
+type MatrixErrors []MatrixError
+
+func (e MatrixErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, matrixErr := range e {
+		messages = append(messages, matrixErr.Error())
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+func (e MatrixErrors) orNil() error {
+	if len(e) == 0 {
+		return nil
+	}
+
+	return e
+}
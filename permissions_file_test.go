@@ -0,0 +1,163 @@
+package iam_client
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParsePermissionsMatrix(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		want     map[string][]string
+		wantErrs MatrixErrors
+	}{
+		{
+			name: "YAML",
+			data: `
+rules:
+  - method: GET
+    path: /api/v1/admin/actionLog
+    permissions: [view:log, admin:log]
+  - method: post
+    path: /api/v1/admin/category/{id:[0-9]+}
+    permissions:
+      - edit:category
+`,
+			want: map[string][]string{
+				"GET/api/v1/admin/actionLog":             {"view:log", "admin:log"},
+				"POST/api/v1/admin/category/{id:[0-9]+}": {"edit:category"},
+			},
+		},
+
+		{
+			name: "Method lists and ANY",
+			data: `
+rules:
+  - method: head|GET
+    path: /api/v1/category
+    permissions: [view:category]
+  - method: [PUT, PATCH]
+    path: /api/v1/category
+    permissions: [edit:category]
+  - method: ANY
+    path: /api/v1/category
+    permissions: [admin]
+`,
+			want: map[string][]string{
+				"GET|HEAD/api/v1/category":  {"view:category"},
+				"PUT|PATCH/api/v1/category": {"edit:category"},
+				"ANY/api/v1/category":       {"admin"},
+			},
+		},
+
+		{
+			name: "JSON",
+			data: `{"rules": [
+				{"method": "GET", "path": "/api/v1/admin/auth-services", "permissions": ["admin"]}
+			]}`,
+			want: map[string][]string{
+				"GET/api/v1/admin/auth-services": {"admin"},
+			},
+		},
+
+		{
+			name: "Validation errors with line numbers",
+			data: `
+rules:
+  - method: GETT
+    path: api/v1/admin/actionLog
+    permissions: ["view::billing", "admin:"]
+  - method: GET
+    path: /api/v1/admin/{id
+    permissions: []
+  - method: GET
+    path: /api/v1/admin/actionLog
+    permissions: [view:log]
+  - method: GET
+    path: /api/v1/admin/actionLog
+    permissions: [admin]
+    scope: foo
+`,
+			wantErrs: MatrixErrors{
+				{Line: 3, Msg: `invalid HTTP method "GETT"`},
+				{Line: 4, Msg: `path "api/v1/admin/actionLog" must start with "/"`},
+				{Line: 5, Msg: `invalid permission "view::billing", expected "base[:scope...]"`},
+				{Line: 5, Msg: `invalid permission "admin:", expected "base[:scope...]"`},
+				{Line: 7, Msg: `path "/api/v1/admin/{id": unbalanced braces`},
+				{Line: 8, Msg: `permissions must not be empty`},
+				{Line: 15, Msg: `unknown rule field "scope"`},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePermissionsMatrix([]byte(tt.data))
+
+			var gotErrs MatrixErrors
+			if err != nil && !errors.As(err, &gotErrs) {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(gotErrs, tt.wantErrs) {
+				t.Errorf("ParsePermissionsMatrix() errors = %v, want %v", gotErrs, tt.wantErrs)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParsePermissionsMatrix() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePermissionsMatrix_overlappingMethodLists(t *testing.T) {
+	_, err := ParsePermissionsMatrix([]byte(`
+rules:
+  - {method: GET|HEAD, path: /api/v1/category, permissions: [view:category]}
+  - {method: HEAD|OPTIONS, path: /api/v1/category, permissions: [admin]}
+`))
+
+	want := `line 4: method HEAD of /api/v1/category is already covered by the rule at line 3`
+	if err == nil || err.Error() != want {
+		t.Errorf("ParsePermissionsMatrix() error = %v, want %v", err, want)
+	}
+}
+
+func TestParsePermissionsMatrix_duplicate(t *testing.T) {
+	_, err := ParsePermissionsMatrix([]byte(`
+rules:
+  - {method: GET, path: /api/v1/admin/actionLog, permissions: [view:log]}
+  - {method: GET, path: /api/v1/admin/actionLog, permissions: [admin]}
+`))
+
+	want := `line 4: duplicate rule GET/api/v1/admin/actionLog, first defined at line 3`
+	if err == nil || err.Error() != want {
+		t.Errorf("ParsePermissionsMatrix() error = %v, want %v", err, want)
+	}
+}
+
+func TestParsePermissionsMatrix_requirementExpressions(t *testing.T) {
+	got, err := ParsePermissionsMatrix([]byte(`
+rules:
+  - method: POST
+    path: /api/v1/category/{id}/approve
+    permissions: ["edit:category & (approve:* | admin)"]
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := map[string][]string{"POST/api/v1/category/{id}/approve": {"edit:category & (approve:* | admin)"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParsePermissionsMatrix() = %v, want %v", got, want)
+	}
+
+	_, err = ParsePermissionsMatrix([]byte(`
+rules:
+  - method: POST
+    path: /api/v1/category/{id}/approve
+    permissions: ["edit:category & (approve:* | admin"]
+`))
+	wantErr := `line 5: permission expression "edit:category & (approve:* | admin": missing ")"`
+	if err == nil || err.Error() != wantErr {
+		t.Errorf("ParsePermissionsMatrix() error = %v, want %v", err, wantErr)
+	}
+}
@@ -0,0 +1,137 @@
+package iam_client
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// GlobalRule глобальное правило: пользователь с правом Permission проходит ко всем ручкам с методами Methods,
+// кроме путей из ExcludePaths, без поиска в матрице доступа
+type GlobalRule struct {
+	// Permission право пользователя, например, "admin:*". Сравнивается точно
+	Permission string
+
+	// Methods методы, на которые распространяется правило, как в ключах матрицы: "GET", "GET|HEAD" или ANY.
+	// Пустой список - все методы. HEAD покрывается, если в списке есть GET
+	Methods []string
+
+	// ExcludePaths шаблоны путей, к которым правило не пускает, в том же синтаксисе, что пути матрицы,
+	// например, "/api/v1/salary/**". Для таких путей применяется матрица доступа, причем Permission
+	// в ней не учитывается: с "view:*" на исключенную ручку с правилом "view:salary" не пустит
+	// (при любом методе запроса)
+	ExcludePaths []string
+}
+
+// DefaultGlobalRules глобальные правила по умолчанию:
+// с правом "admin:*" пускаем ко всем ручкам, с правом "view:*" - ко всем GET- и HEAD-ручкам
+func DefaultGlobalRules() []GlobalRule {
+	return []GlobalRule{
+		{Permission: "admin:*"},
+		{Permission: "view:*", Methods: []string{http.MethodGet}},
+	}
+}
+
+// globalRule скомпилированное GlobalRule
+type globalRule struct {
+	GlobalRule
+	exclude pathTrie[struct{}]
+}
+
+// WithGlobalRules заменяет глобальные правила (по умолчанию DefaultGlobalRules).
+// Вызов без аргументов отключает глобальные правила: все запросы проверяются только по матрице.
+func (p *PermissionsChecker) WithGlobalRules(rules ...GlobalRule) error {
+	compiled, err := compileGlobalRules(rules)
+	if err != nil {
+		return err
+	}
+	p.globalRules = compiled
+
+	return nil
+}
+
+func compileGlobalRules(rules []GlobalRule) ([]globalRule, error) {
+	compiled := make([]globalRule, 0, len(rules))
+	for _, rule := range rules {
+		if rule.Permission == "" {
+			return nil, errors.New("global rule without permission")
+		}
+		methods, err := globalRuleMethods(rule.Methods)
+		if err != nil {
+			return nil, errors.Wrapf(err, "global rule %s", rule.Permission)
+		}
+
+		c := globalRule{GlobalRule: rule}
+		c.Methods = methods
+		for _, path := range rule.ExcludePaths {
+			if err := validateMatrixPath(path); err != nil {
+				return nil, errors.Wrapf(err, "global rule %s", rule.Permission)
+			}
+			if _, _, err := c.exclude.insert(path, struct{}{}); err != nil {
+				return nil, errors.Wrapf(err, "global rule %s", rule.Permission)
+			}
+		}
+		compiled = append(compiled, c)
+	}
+
+	return compiled, nil
+}
+
+// matchGlobalRule ищет глобальное правило, которое пускает пользователя к ручке, и возвращает его право.
+// Если путь исключен из правила, право правила исключается и из проверки по матрице (index.excluded):
+// иначе "view:*" давал бы "view:salary" через "*" в скоупе и ExcludePaths ничего бы не защищал
+func (p *PermissionsChecker) matchGlobalRule(r *http.Request, index *permissionIndex) (string, bool) {
+	for i := range p.globalRules {
+		rule := &p.globalRules[i]
+		if !index.has(rule.Permission) {
+			continue
+		}
+		if _, excluded := rule.exclude.lookup(r.URL.Path, nil); excluded {
+			index.excluded = append(index.excluded, rule.Permission)
+			continue
+		}
+		if !rule.coversMethod(r.Method) {
+			continue
+		}
+
+		return rule.Permission, true
+	}
+
+	return "", false
+}
+
+// globalRuleMethods приводит методы глобального правила к тем же правилам, что и методы ключей матрицы:
+// регистр не важен, "GET|HEAD" - список методов, ANY - все методы (пустой список)
+func globalRuleMethods(methods []string) ([]string, error) {
+	var result []string
+	for _, method := range methods {
+		method = canonicalMethods(method)
+		if err := validateMatrixMethod(method); err != nil {
+			return nil, err
+		}
+		if method == MethodAny {
+			return nil, nil
+		}
+		for _, m := range strings.Split(method, "|") {
+			if !InArray(result, m) {
+				result = append(result, m)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// super правило без ограничения по методам дает супер-право: любое право на путях вне ExcludePaths
+func (rule *globalRule) super() bool {
+	return len(rule.Methods) == 0
+}
+
+func (rule *globalRule) coversMethod(method string) bool {
+	if len(rule.Methods) == 0 {
+		return true
+	}
+
+	return InArray(rule.Methods, method) || (method == http.MethodHead && InArray(rule.Methods, http.MethodGet))
+}
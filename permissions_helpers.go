@@ -0,0 +1,209 @@
+package iam_client
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// Хелперы для проверок внутри ручек, например, "может ли пользователь видеть колонку с зарплатой".
+// Права сравниваются так же, как в PermissionsChecker (см. segmentsGranted): право без скоупа
+// и "*" в скоупе дают любой скоуп. Глобальное правило решает, пускать ли пользователя к ручке, и само
+// по себе прав не дает. Исключение - супер-права: правила без ограничения по методам (по умолчанию "admin:*")
+// дают любое право. Хелперы по контексту узнают о супер-праве от middleware PermissionsChecker
+// (см. withSuperPermission), поэтому учитывают настройки WithGlobalRules только после этих middleware.
+// Методы PermissionsChecker.HasPermission, HasAny и HasAll проверяют глобальные правила сами.
+
+// HasPermission проверяет, что у пользователя из контекста есть право permission, например, "view:salary"
+func HasPermission(ctx context.Context, permission string) bool {
+	return GetPrincipal(ctx).HasPermission(permission)
+}
+
+// HasAny проверяет, что у пользователя из контекста есть хотя бы одно из прав permissions
+func HasAny(ctx context.Context, permissions ...string) bool {
+	return GetPrincipal(ctx).HasAny(permissions...)
+}
+
+// HasAll проверяет, что у пользователя из контекста есть все права permissions
+func HasAll(ctx context.Context, permissions ...string) bool {
+	return GetPrincipal(ctx).HasAll(permissions...)
+}
+
+// ScopesFor возвращает скоупы права base, которые есть у пользователя из контекста, см. Principal.ScopesFor
+func ScopesFor(ctx context.Context, base string) (scopes []string, all bool) {
+	return GetPrincipal(ctx).ScopesFor(base)
+}
+
+// HasPermission проверяет, что у пользователя есть право permission
+func (p Principal) HasPermission(permission string) bool {
+	if permission == "" {
+		return false
+	}
+
+	if p.SuperPermission != "" {
+		return true
+	}
+
+	required := strings.Split(permission, ":")
+	for _, userPermission := range p.Permissions {
+		if segmentsGranted(required, userPermission) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasAny проверяет, что у пользователя есть хотя бы одно из прав permissions
+func (p Principal) HasAny(permissions ...string) bool {
+	for _, permission := range permissions {
+		if p.HasPermission(permission) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasAll проверяет, что у пользователя есть все права permissions. Для пустого списка возвращает false
+func (p Principal) HasAll(permissions ...string) bool {
+	for _, permission := range permissions {
+		if !p.HasPermission(permission) {
+			return false
+		}
+	}
+
+	return len(permissions) > 0
+}
+
+// ScopesFor возвращает скоупы права base, которые есть у пользователя, например, для фильтрации
+// запроса в БД. Для прав "edit:category:1" и "edit:category:2" ScopesFor("edit:category") вернет
+// []string{"1", "2"}, а ScopesFor("edit") - []string{"category:1", "category:2"}.
+// Если у пользователя есть base без скоупа или с "*" ("edit", "edit:*", "edit:category:*"),
+// возвращается all = true: ограничивать выборку не нужно. То же для супер-права (SuperPermission).
+func (p Principal) ScopesFor(base string) (scopes []string, all bool) {
+	if base == "" {
+		return nil, false
+	}
+
+	if p.SuperPermission != "" {
+		return nil, true
+	}
+
+	baseSegments := strings.Split(base, ":")
+	for _, userPermission := range p.Permissions {
+		scope, found := scopeWithin(baseSegments, userPermission)
+		if !found {
+			continue
+		}
+		if scope == "" || scope == "*" {
+			return nil, true
+		}
+		if !InArray(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return scopes, false
+}
+
+// HasPermission проверяет, что пользователь запроса r получает право permission по тем же правилам,
+// что и AuthMiddlewareHandler: с ролями WithRoles, супер-правами глобальных правил чекера и ExcludePaths
+// для пути r. Для echo передается c.Request()
+func (p *PermissionsChecker) HasPermission(r *http.Request, permission string) bool {
+	return p.HasAll(r, permission)
+}
+
+// HasAny проверяет, что пользователь запроса r получает хотя бы одно из прав permissions, см. HasPermission
+func (p *PermissionsChecker) HasAny(r *http.Request, permissions ...string) bool {
+	index, super := p.helperIndex(r)
+	for _, permission := range permissions {
+		if permission != "" && (super || index.granted(permission)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasAll проверяет, что пользователь запроса r получает все права permissions, см. HasPermission.
+// Для пустого списка возвращает false
+func (p *PermissionsChecker) HasAll(r *http.Request, permissions ...string) bool {
+	index, super := p.helperIndex(r)
+	for _, permission := range permissions {
+		if permission == "" || !super && !index.granted(permission) {
+			return false
+		}
+	}
+
+	return len(permissions) > 0
+}
+
+// helperIndex индексирует права пользователя запроса и проверяет глобальные правила.
+// super = true, если у пользователя есть супер-право для пути r. Права правил, исключенных на пути r,
+// попадают в index.excluded, как в matchGlobalRule
+func (p *PermissionsChecker) helperIndex(r *http.Request) (index permissionIndex, super bool) {
+	userPermissions := GetPermissions(r.Context())
+	if p.roles != nil && p.roles.hasRole(userPermissions) {
+		userPermissions = p.roles.Expand(userPermissions)
+	}
+
+	index = newPermissionIndex(userPermissions)
+	for i := range p.globalRules {
+		rule := &p.globalRules[i]
+		if !index.has(rule.Permission) {
+			continue
+		}
+		if _, excluded := rule.exclude.lookup(r.URL.Path, nil); excluded {
+			index.excluded = append(index.excluded, rule.Permission)
+			continue
+		}
+		if rule.super() {
+			super = true
+		}
+	}
+
+	return index, super
+}
+
+// ctxSuperPermission ключ контекста для супер-права, см. withSuperPermission
+type ctxSuperPermission struct{}
+
+// withSuperPermission кладет в контекст супер-право, по которому decision пустил к ручке, для хелперов
+// HasPermission и ScopesFor. Контекст копируется только для таких запросов
+func (p *PermissionsChecker) withSuperPermission(r *http.Request, decision Decision) *http.Request {
+	if decision.Source != MatchGlobal || !decision.Allowed || decision.Shadowed {
+		return r
+	}
+	for i := range p.globalRules {
+		if rule := &p.globalRules[i]; rule.Permission == decision.GlobalRule && rule.super() {
+			return r.WithContext(context.WithValue(r.Context(), ctxSuperPermission{}, rule.Permission))
+		}
+	}
+
+	return r
+}
+
+// GetSuperPermission возвращает супер-право, по которому PermissionsChecker пустил пользователя к ручке,
+// или "", см. Principal.SuperPermission
+func GetSuperPermission(ctx context.Context) string {
+	permission, _ := ctx.Value(ctxSuperPermission{}).(string)
+	return permission
+}
+
+// scopeWithin проверяет, что право пользователя относится к base, и возвращает его скоуп ниже base.
+// Пустой скоуп означает, что право дает base целиком
+func scopeWithin(baseSegments []string, userPermission string) (string, bool) {
+	for i, baseSegment := range baseSegments {
+		userSegment, userRest, userMore := strings.Cut(userPermission, ":")
+		if baseSegment != userSegment && (i == 0 || userSegment != "*") {
+			return "", false
+		}
+		if !userMore {
+			return "", true
+		}
+		userPermission = userRest
+	}
+
+	return userPermission, true
+}
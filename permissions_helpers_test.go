@@ -0,0 +1,211 @@
+package iam_client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestHasPermission(t *testing.T) {
+	ctx := context.WithValue(context.Background(), CtxIamPermissions{}, []string{"view:salary:*", "edit:category:42", "approve"})
+
+	tests := []struct {
+		name       string
+		permission string
+		want       bool
+	}{
+		{name: "Wildcard scope", permission: "view:salary:department", want: true},
+		{name: "Wider than the user permission", permission: "view:salary", want: true},
+		{name: "Scope", permission: "edit:category:42", want: true},
+		{name: "Other scope", permission: "edit:category:43", want: false},
+		{name: "Permission without a scope", permission: "approve:category", want: true},
+		{name: "Other permission", permission: "view:log", want: false},
+		{name: "Empty", permission: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HasPermission(ctx, tt.permission); got != tt.want {
+				t.Errorf("HasPermission(%q) = %v, want %v", tt.permission, got, tt.want)
+			}
+		})
+	}
+
+	if !HasAny(ctx, "view:log", "edit:category:42") || HasAny(ctx, "view:log") || HasAny(ctx) {
+		t.Error("HasAny() is wrong")
+	}
+	if !HasAll(ctx, "approve", "edit:category:42") || HasAll(ctx, "approve", "view:log") || HasAll(ctx) {
+		t.Error("HasAll() is wrong")
+	}
+	if HasPermission(context.Background(), "view") {
+		t.Error("HasPermission() without permissions in the context = true")
+	}
+}
+
+func TestHasPermission_superPermission(t *testing.T) {
+	tests := []struct {
+		name        string
+		globalRules []GlobalRule
+		method      string
+		want        bool
+	}{
+		{name: "Default rules", globalRules: DefaultGlobalRules(), method: http.MethodPost, want: true},
+		{name: "Global rules are off", method: http.MethodPost, want: false},
+		{name: "Rule limited by methods", globalRules: []GlobalRule{{Permission: "admin:*", Methods: []string{http.MethodPost}}}, method: http.MethodPost, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPermissionsChecker(map[string][]string{"ANY/api/v1/report": {"admin"}}, nopLogger{})
+			if err := p.WithGlobalRules(tt.globalRules...); err != nil {
+				t.Fatal(err)
+			}
+
+			var got, gotAll bool
+			handler := p.AuthMiddlewareHandler(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = HasPermission(r.Context(), "view:salary")
+				_, gotAll = ScopesFor(r.Context(), "edit:category")
+			}))
+			r := httptest.NewRequest(tt.method, "/api/v1/report", nil)
+			r = r.WithContext(context.WithValue(r.Context(), CtxIamPermissions{}, []string{"admin:*"}))
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+			if got != tt.want || gotAll != tt.want {
+				t.Errorf(`HasPermission("view:salary") = %v, ScopesFor() all = %v, want %v`, got, gotAll, tt.want)
+			}
+		})
+	}
+
+	p := NewPermissionsChecker(map[string][]string{}, nopLogger{})
+	p.WithEchoContextKeys(DefaultEchoContextKeys)
+	e := echo.New()
+	var gotEcho bool
+	e.POST("/api/v1/report", func(c echo.Context) error {
+		principal, _ := EchoGetPrincipal(c)
+		gotEcho = principal.HasPermission("view:salary")
+		return nil
+	}, p.EchoAuthMiddlewareHandler())
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/report", nil)
+	e.ServeHTTP(httptest.NewRecorder(), r.WithContext(context.WithValue(r.Context(), CtxIamPermissions{}, []string{"admin:*"})))
+	if !gotEcho {
+		t.Error(`echo Principal.HasPermission("view:salary") with "admin:*" = false`)
+	}
+
+	// Без middleware чекера "admin:*" - обычное право
+	ctx := context.WithValue(context.Background(), CtxIamPermissions{}, []string{"admin:*"})
+	if HasPermission(ctx, "view:salary") {
+		t.Error(`HasPermission("view:salary") with "admin:*" outside of the checker = true`)
+	}
+}
+
+func TestPermissionsChecker_HasPermission(t *testing.T) {
+	p := NewPermissionsChecker(map[string][]string{
+		"GET/api/v1/salary/{id}": {"view:salary"},
+	}, nopLogger{})
+	if err := p.WithGlobalRules(
+		GlobalRule{Permission: "admin:*"},
+		GlobalRule{Permission: "view:*", Methods: []string{http.MethodGet}, ExcludePaths: []string{"/api/v1/salary/**"}},
+		GlobalRule{Permission: "delete:*", Methods: []string{http.MethodGet, http.MethodDelete}},
+	); err != nil {
+		t.Fatal(err)
+	}
+	roles, err := NewRoles(map[string][]string{"accountant": {"view:salary"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.WithRoles(roles)
+
+	tests := []struct {
+		name            string
+		method          string
+		path            string
+		userPermissions []string
+		permission      string
+		want            bool
+	}{
+		{name: "Super-permission", method: http.MethodPost, path: "/api/v1/salary/42", userPermissions: []string{"admin:*"}, permission: "view:salary", want: true},
+		{name: "Global rule does not grant other permissions", method: http.MethodGet, path: "/api/v1/category/42", userPermissions: []string{"view:*"}, permission: "edit:category", want: false},
+		{name: "Permission of a global rule", method: http.MethodGet, path: "/api/v1/category/42", userPermissions: []string{"view:*"}, permission: "view:category", want: true},
+		{name: "Super-permission limited by methods", method: http.MethodGet, path: "/api/v1/category/42", userPermissions: []string{"delete:*"}, permission: "edit:category", want: false},
+		{name: "Global rule for another method", method: http.MethodPost, path: "/api/v1/category/42", userPermissions: []string{"view:*"}, permission: "edit:category", want: false},
+		{name: "Excluded path", method: http.MethodGet, path: "/api/v1/salary/42", userPermissions: []string{"view:*"}, permission: "view:salary", want: false},
+		{name: "Excluded path, explicit permission", method: http.MethodGet, path: "/api/v1/salary/42", userPermissions: []string{"view:*", "view:salary"}, permission: "view:salary", want: true},
+		{name: "Role", method: http.MethodGet, path: "/api/v1/salary/42", userPermissions: []string{"role:accountant"}, permission: "view:salary:42", want: true},
+		{name: "No permission", method: http.MethodGet, path: "/api/v1/salary/42", userPermissions: []string{"view:log"}, permission: "view:salary", want: false},
+		{name: "Empty", method: http.MethodGet, path: "/api/v1/salary/42", userPermissions: []string{"admin:*"}, permission: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			r = r.WithContext(context.WithValue(r.Context(), CtxIamPermissions{}, tt.userPermissions))
+			if got := p.HasPermission(r, tt.permission); got != tt.want {
+				t.Errorf("HasPermission(%q) = %v, want %v", tt.permission, got, tt.want)
+			}
+			if got := p.HasAny(r, "", tt.permission); got != tt.want {
+				t.Errorf("HasAny(%q) = %v, want %v", tt.permission, got, tt.want)
+			}
+		})
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/salary/42", nil)
+	r = r.WithContext(context.WithValue(r.Context(), CtxIamPermissions{}, []string{"view:*", "view:salary"}))
+	if !p.HasAll(r, "view:salary", "view:salary:42") || p.HasAll(r, "view:salary", "view:log") || p.HasAll(r) {
+		t.Error("HasAll() is wrong")
+	}
+}
+
+func TestScopesFor(t *testing.T) {
+	tests := []struct {
+		name            string
+		userPermissions []string
+		base            string
+		wantScopes      []string
+		wantAll         bool
+	}{
+		{
+			name:            "Concrete scopes",
+			userPermissions: []string{"edit:category:1", "edit:category:2", "edit:item:3", "view:category:4", "edit:category:1"},
+			base:            "edit:category",
+			wantScopes:      []string{"1", "2"},
+		},
+		{
+			name:            "Nested scopes",
+			userPermissions: []string{"edit:category:1", "edit:item"},
+			base:            "edit",
+			wantScopes:      []string{"category:1", "item"},
+		},
+		{
+			name:            "Wildcard in a scope",
+			userPermissions: []string{"edit:*:1", "edit:category:2"},
+			base:            "edit:category",
+			wantScopes:      []string{"1", "2"},
+		},
+		{
+			name:            "Permission without a scope",
+			userPermissions: []string{"edit:category:1", "edit"},
+			base:            "edit:category",
+			wantAll:         true,
+		},
+		{
+			name:            "Wildcard scope",
+			userPermissions: []string{"edit:category:*"},
+			base:            "edit:category",
+			wantAll:         true,
+		},
+		{
+			name:            "No permissions",
+			userPermissions: []string{"view:category:1", "editor:category:2"},
+			base:            "edit:category",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), CtxIamPermissions{}, tt.userPermissions)
+			scopes, all := ScopesFor(ctx, tt.base)
+			if !reflect.DeepEqual(scopes, tt.wantScopes) || all != tt.wantAll {
+				t.Errorf("ScopesFor(%q) = %v, %v, want %v, %v", tt.base, scopes, all, tt.wantScopes, tt.wantAll)
+			}
+		})
+	}
+}
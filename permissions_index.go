@@ -0,0 +1,121 @@
+package iam_client
+
+import (
+	"slices"
+	"strings"
+)
+
+// permissionIndexThreshold число прав пользователя, начиная с которого их может быть выгодно индексировать,
+// и permissionIndexLookups - число поисков по списку, после которого индекс строится. Сортировка длинного
+// списка дороже нескольких линейных проходов, поэтому обычный запрос (одно-два права в правиле) индекс не строит
+const (
+	permissionIndexThreshold = 16
+	permissionIndexLookups   = 8
+)
+
+// permissionIndex права пользователя для проверки требований. Создается один раз на запрос без выделения памяти.
+// Если по длинному списку ищут много раз (большие выражения), он копируется и сортируется (одна аллокация),
+// чтобы права с нужной базой ("edit" для "edit:category:42") находились бинарным поиском
+type permissionIndex struct {
+	all    []string
+	sorted []string
+	// lookups число линейных поисков по all
+	lookups int
+	// excluded права глобальных правил, исключенные на пути запроса, см. matchGlobalRule. Доступа они не дают
+	excluded []string
+}
+
+func newPermissionIndex(userPermissions []string) permissionIndex {
+	return permissionIndex{all: userPermissions}
+}
+
+// has проверяет точное наличие права у пользователя. Нужен только глобальным правилам, которых мало,
+// поэтому индекс не строит
+func (index *permissionIndex) has(permission string) bool {
+	return InArray(index.all, permission)
+}
+
+// grantedBy возвращает право пользователя, которое дает требуемое право, разбитое на сегменты
+func (index *permissionIndex) grantedBy(required []string) (string, bool) {
+	if index.sorted == nil && len(index.all) >= permissionIndexThreshold {
+		index.lookups++
+		if index.lookups > permissionIndexLookups {
+			index.sorted = slices.Clone(index.all)
+			slices.Sort(index.sorted)
+		}
+	}
+
+	if index.sorted == nil {
+		for _, userPermission := range index.all {
+			if segmentsGranted(required, userPermission) && !index.isExcluded(userPermission) {
+				return userPermission, true
+			}
+		}
+		return "", false
+	}
+
+	// Право без скоупа, равное базе
+	base := required[0]
+	if i, found := slices.BinarySearch(index.sorted, base); found && !index.isExcluded(base) {
+		return index.sorted[i], true
+	}
+
+	// Права "base:...", в отсортированном списке они идут подряд
+	start, _ := slices.BinarySearchFunc(index.sorted, base, compareWithScope)
+	for _, userPermission := range index.sorted[start:] {
+		if len(userPermission) <= len(base) || userPermission[len(base)] != ':' || userPermission[:len(base)] != base {
+			break
+		}
+		if segmentsGranted(required, userPermission) && !index.isExcluded(userPermission) {
+			return userPermission, true
+		}
+	}
+
+	return "", false
+}
+
+// granted проверяет право в записи матрицы, например, "view:salary"
+func (index *permissionIndex) granted(permission string) bool {
+	_, found := index.grantedBy(strings.Split(permission, ":"))
+	return found
+}
+
+func (index *permissionIndex) isExcluded(permission string) bool {
+	return len(index.excluded) > 0 && InArray(index.excluded, permission)
+}
+
+// compareWithScope сравнивает s с base+":" без склейки строк. Никогда не возвращает 0,
+// поэтому бинарный поиск находит первую строку, которая не меньше base+":"
+func compareWithScope(s, base string) int {
+	if len(s) > len(base) {
+		if c := strings.Compare(s[:len(base)], base); c != 0 {
+			return c
+		}
+		if s[len(base)] < ':' {
+			return -1
+		}
+		return 1
+	}
+
+	if c := strings.Compare(s, base[:len(s)]); c != 0 {
+		return c
+	}
+
+	return -1
+}
+
+// segmentsGranted - permissionGranted для требуемого права, заранее разбитого на сегменты
+func segmentsGranted(required []string, userPermission string) bool {
+	for i, requiredSegment := range required {
+		userSegment, userRest, userMore := strings.Cut(userPermission, ":")
+		if requiredSegment != userSegment && (i == 0 || userSegment != "*") {
+			return false
+		}
+		if !userMore {
+			return true
+		}
+		userPermission = userRest
+	}
+
+	return true
+}
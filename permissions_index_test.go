@@ -0,0 +1,34 @@
+package iam_client
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPermissionIndex_grantedBy(t *testing.T) {
+	tests := []struct {
+		name            string
+		required        string
+		userPermissions []string
+		want            string
+		wantFound       bool
+	}{
+		{name: "Base without a scope", required: "edit:category:42", userPermissions: []string{"edit"}, want: "edit", wantFound: true},
+		{name: "Scope", required: "edit:category:42", userPermissions: []string{"edit:category"}, want: "edit:category", wantFound: true},
+		{name: "Wildcard scope", required: "edit:category:42", userPermissions: []string{"edit:*:42"}, want: "edit:*:42", wantFound: true},
+		{name: "Scope mismatch", required: "edit:category:42", userPermissions: []string{"edit:category:43", "edit:item"}},
+		{name: "Base prefix is not a base", required: "edit:category", userPermissions: []string{"editor", "edit-", "edit0:category"}},
+		{name: "Wildcard base", required: "edit:category", userPermissions: []string{"*:category"}},
+	}
+	for _, tt := range tests {
+		for _, n := range []int{0, permissionIndexThreshold} {
+			t.Run(tt.name, func(t *testing.T) {
+				index := newPermissionIndex(append(benchmarkPermissions(n), tt.userPermissions...))
+				got, found := index.grantedBy(strings.Split(tt.required, ":"))
+				if got != tt.want || found != tt.wantFound {
+					t.Errorf("grantedBy() with %d permissions = %q, %v, want %q, %v", n, got, found, tt.want, tt.wantFound)
+				}
+			})
+		}
+	}
+}
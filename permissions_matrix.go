@@ -0,0 +1,180 @@
+package iam_client
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// MethodAny метод в ключе матрицы, под который попадают все методы, например, "ANY/api/v1/health"
+const MethodAny = "ANY"
+
+// OptionsPolicy определяет, как PermissionsChecker обрабатывает запросы OPTIONS
+type OptionsPolicy int
+
+const (
+	// OptionsMatrix OPTIONS проверяется по матрице как любой другой метод, ANY на него распространяется
+	OptionsMatrix OptionsPolicy = iota
+	// OptionsAllow OPTIONS пропускается без проверки прав, например, для CORS preflight
+	OptionsAllow
+	// OptionsExplicitOnly OPTIONS проверяется по матрице, но только по ключам, где OPTIONS указан явно,
+	// ANY на него не распространяется
+	OptionsExplicitOnly
+)
+
+// matrixSnapshot неизменяемый снимок матрицы доступа. Middleware всегда работают с одним снимком,
+// замена матрицы на лету атомарно подменяет снимок целиком.
+type matrixSnapshot struct {
+	// byPath правила по точному шаблону пути, для точного совпадения и шаблонов из роутеров
+	byPath map[string]*matrixRoute
+	// routes дерево путей матрицы для встроенного матчера
+	routes pathTrie[*matrixRoute]
+}
+
+// matrixRoute правила матрицы для одного шаблона пути
+type matrixRoute struct {
+	// methods правила с одним методом, "GET/path"
+	methods map[string]*matrixRule
+	// lists правила со списком методов, "GET|HEAD/path", по каждому методу списка
+	lists map[string]*matrixRule
+	// any правило "ANY/path"
+	any *matrixRule
+}
+
+// matrixRule одно правило матрицы
+type matrixRule struct {
+	// key исходный ключ матрицы
+	key         string
+	permissions []string
+	// requirement скомпилированные permissions. Если разобрать их не удалось - nil, такое правило никого не пускает
+	requirement *requirement
+	// bound для проверки правила нужны параметры пути
+	bound bool
+}
+
+// allows проверяет права пользователя по правилу, params - параметры пути для плейсхолдеров в правах.
+// Если granted не nil, в него дописываются права пользователя, давшие доступ
+func (rule *matrixRule) allows(index *permissionIndex, params []pathParam, granted *[]string) bool {
+	return rule.requirement != nil && rule.requirement.evalGranted(index, params, granted)
+}
+
+// rule выбирает правило для метода. Порядок поиска:
+//  1. ключ с этим методом, "GET/path";
+//  2. ключ со списком методов, в который входит этот метод, "GET|HEAD/path";
+//  3. для HEAD - то же самое для GET;
+//  4. ключ "ANY/path" (для OPTIONS - только при политике OptionsMatrix).
+func (route *matrixRoute) rule(method string, optionsPolicy OptionsPolicy) *matrixRule {
+	if rule := route.exact(method); rule != nil {
+		return rule
+	}
+	if method == http.MethodHead {
+		if rule := route.exact(http.MethodGet); rule != nil {
+			return rule
+		}
+	}
+	if method == http.MethodOptions && optionsPolicy == OptionsExplicitOnly {
+		return nil
+	}
+
+	return route.any
+}
+
+func (route *matrixRoute) exact(method string) *matrixRule {
+	if rule, found := route.methods[method]; found {
+		return rule
+	}
+
+	return route.lists[method]
+}
+
+func newMatrixSnapshot(permissionsMatrix map[string][]string) (*matrixSnapshot, error) {
+	snapshot := &matrixSnapshot{byPath: make(map[string]*matrixRoute)}
+	var errs MatrixErrors
+	for key, permissions := range permissionsMatrix {
+		methods, path, err := parseMatrixKey(key)
+		if err != nil {
+			errs = append(errs, MatrixError{Msg: err.Error()})
+			continue
+		}
+
+		route, found := snapshot.byPath[path]
+		if !found {
+			route = &matrixRoute{methods: make(map[string]*matrixRule), lists: make(map[string]*matrixRule)}
+			if _, _, err := snapshot.routes.insert(path, route); err != nil {
+				errs = append(errs, MatrixError{Msg: err.Error()})
+				continue
+			}
+			snapshot.byPath[path] = route
+		}
+
+		rule := &matrixRule{key: key, permissions: permissions}
+		rule.requirement, err = compileRequirement(permissions)
+		for _, permission := range permissions {
+			if err == nil {
+				err = validateRequirementParams(permission, path)
+			}
+		}
+		if err != nil {
+			// Как до появления выражений: права сравниваются как есть, без разбора и плейсхолдеров
+			rule.requirement = legacyRequirement(permissions)
+			errs = append(errs, MatrixError{Msg: key + ": " + err.Error()})
+		} else {
+			rule.bound = rule.requirement.hasPlaceholders()
+		}
+		switch {
+		case methods == nil:
+			if route.any != nil {
+				errs = append(errs, MatrixError{Msg: fmt.Sprintf("%s duplicates %s", key, route.any.key)})
+				continue
+			}
+			route.any = rule
+
+		case len(methods) == 1:
+			if existing, found := route.methods[methods[0]]; found {
+				errs = append(errs, MatrixError{Msg: fmt.Sprintf("%s duplicates %s", key, existing.key)})
+				continue
+			}
+			route.methods[methods[0]] = rule
+
+		default:
+			for _, method := range methods {
+				if existing, found := route.lists[method]; found {
+					errs = append(errs, MatrixError{Msg: fmt.Sprintf("method %s of %s is covered by both %s and %s", method, path, existing.key, key)})
+					continue
+				}
+				route.lists[method] = rule
+			}
+		}
+	}
+
+	return snapshot, errs.orNil()
+}
+
+// parseMatrixKey разбирает ключ матрицы вида METHOD/path, METHOD1|METHOD2/path или ANY/path.
+// Для ANY возвращает methods == nil.
+func parseMatrixKey(key string) (methods []string, path string, err error) {
+	i := strings.IndexByte(key, '/')
+	if i < 0 {
+		return nil, "", errors.Errorf("invalid key %q, expected METHOD/path", key)
+	}
+	if key[:i] == MethodAny {
+		return nil, key[i:], nil
+	}
+
+	return strings.Split(key[:i], "|"), key[i:], nil
+}
+
+// validateMatrixKey проверяет ключ матрицы вида METHOD/path
+func validateMatrixKey(key string) error {
+	i := strings.IndexByte(key, '/')
+	if i < 0 {
+		return errors.Errorf("invalid key %q, expected METHOD/path", key)
+	}
+	if err := validateMatrixMethod(key[:i]); err != nil {
+		return errors.Wrapf(err, "key %q", key)
+	}
+
+	return validateMatrixPath(key[i:])
+}
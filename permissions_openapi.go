@@ -0,0 +1,217 @@
+package iam_client
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// OpenAPIPermissionsExtension расширение операции OpenAPI с правами доступа к ней:
+//
+//	paths:
+//	  /api/v1/category/{id}:
+//	    delete:
+//	      x-iam-permissions: ["edit:category:{id}", admin]
+//	    get:
+//	      x-iam-permissions: "view:category"
+//
+// Значение - список выражений над правами (как значения матрицы доступа) или одно выражение строкой.
+const OpenAPIPermissionsExtension = "x-iam-permissions"
+
+// openAPIMethods методы, которые могут быть операциями в path item OpenAPI
+var openAPIMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// OpenAPIPermissions правила доступа, собранные из спецификации OpenAPI 3
+type OpenAPIPermissions struct {
+	// PermissionsMatrix матрица доступа из операций с расширением x-iam-permissions, для NewPermissionsChecker
+	PermissionsMatrix map[string][]string
+	// Operations все операции спецификации, с расширением и без. Их можно передать в Validate:
+	// операции без расширения (и без других правил) попадут в CoverageReport.UncoveredRoutes
+	Operations []Route
+}
+
+// NewPermissionsCheckerFromOpenAPI читает спецификацию OpenAPI 3 из YAML или JSON файла и возвращает
+// PermissionsChecker с матрицей доступа из x-iam-permissions. Операции для Validate дает LoadOpenAPIPermissions
+func NewPermissionsCheckerFromOpenAPI(path string, log Logger) (*PermissionsChecker, error) {
+	permissions, err := LoadOpenAPIPermissions(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPermissionsChecker(permissions.PermissionsMatrix, log), nil
+}
+
+// LoadOpenAPIPermissions читает спецификацию OpenAPI 3 из YAML или JSON файла, см. ParseOpenAPIPermissions
+func LoadOpenAPIPermissions(path string) (*OpenAPIPermissions, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read OpenAPI spec")
+	}
+
+	permissions, err := ParseOpenAPIPermissions(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "OpenAPI spec %s", path)
+	}
+
+	return permissions, nil
+}
+
+// ParseOpenAPIPermissions собирает правила доступа из расширения x-iam-permissions операций спецификации
+// OpenAPI 3 в формате YAML или JSON. Пути берутся из "paths" как есть (префикс из "servers" не добавляется)
+// и ищутся встроенным матчером, макросы {param} можно использовать в плейсхолдерах прав.
+// Path items с $ref на другие path items документа разворачиваются, ссылки на другие файлы - ошибка.
+// Ошибки валидации возвращаются в виде MatrixErrors с номерами строк.
+func ParseOpenAPIPermissions(data []byte) (*OpenAPIPermissions, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, MatrixErrors{{Line: 1, Msg: "expected an OpenAPI document"}}
+	}
+
+	root := doc.Content[0]
+	version := mappingValue(root, "openapi")
+	if version == nil || !strings.HasPrefix(version.Value, "3.") {
+		return nil, MatrixErrors{{Line: root.Line, Msg: "expected an OpenAPI 3 document"}}
+	}
+
+	result := &OpenAPIPermissions{PermissionsMatrix: make(map[string][]string)}
+	paths := mappingValue(root, "paths")
+	if paths == nil {
+		return result, nil
+	}
+	if paths.Kind != yaml.MappingNode {
+		return nil, MatrixErrors{{Line: paths.Line, Msg: "\"paths\" must be a mapping"}}
+	}
+
+	var errs MatrixErrors
+	for i := 0; i+1 < len(paths.Content); i += 2 {
+		pathNode, item := paths.Content[i], paths.Content[i+1]
+		path := pathNode.Value
+		if err := validateMatrixPath(path); err != nil {
+			errs = append(errs, MatrixError{Line: pathNode.Line, Msg: err.Error()})
+			continue
+		}
+		if item.Kind != yaml.MappingNode {
+			continue
+		}
+		items, err := resolvePathItem(root, item)
+		if err != nil {
+			errs = append(errs, MatrixError{Line: item.Line, Msg: err.Error()})
+			continue
+		}
+
+		for _, method := range openAPIMethods {
+			var operation *yaml.Node
+			for _, item := range items {
+				if operation = mappingValue(item, method); operation != nil {
+					break
+				}
+			}
+			if operation == nil || operation.Kind != yaml.MappingNode {
+				continue
+			}
+			route := Route{Method: strings.ToUpper(method), Path: path}
+			result.Operations = append(result.Operations, route)
+
+			extension := mappingValue(operation, OpenAPIPermissionsExtension)
+			if extension == nil {
+				continue
+			}
+			permissions, permissionErrs := parseOpenAPIPermissions(extension, path)
+			errs = append(errs, permissionErrs...)
+			if len(permissionErrs) == 0 {
+				result.PermissionsMatrix[route.String()] = permissions
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return result, nil
+}
+
+// openAPIMaxRefs ограничение на длину цепочки $ref, защищает от циклов
+const openAPIMaxRefs = 16
+
+// resolvePathItem возвращает path item и все path items, на которые он ссылается через $ref.
+// Поддерживаются только ссылки внутри документа ("#/paths/...", "#/components/pathItems/..."),
+// ссылки на другие файлы - ошибка: иначе их операции молча пропали бы из матрицы и отчета о покрытии.
+// Поля самого path item приоритетнее полей по ссылке
+func resolvePathItem(root, item *yaml.Node) ([]*yaml.Node, error) {
+	items := []*yaml.Node{item}
+	for ref := mappingValue(item, "$ref"); ref != nil; ref = mappingValue(item, "$ref") {
+		if len(items) > openAPIMaxRefs {
+			return nil, errors.Errorf("$ref %q: too many nested references", ref.Value)
+		}
+		if ref.Kind != yaml.ScalarNode || !strings.HasPrefix(ref.Value, "#/") {
+			return nil, errors.Errorf("$ref %q: only local references (#/...) are supported", ref.Value)
+		}
+
+		item = root
+		for _, token := range strings.Split(ref.Value[2:], "/") {
+			token, err := url.PathUnescape(token)
+			if err != nil {
+				return nil, errors.Wrapf(err, "$ref %q", ref.Value)
+			}
+			token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+			if item = mappingValue(item, token); item == nil {
+				return nil, errors.Errorf("$ref %q: not found", ref.Value)
+			}
+		}
+		if item.Kind != yaml.MappingNode {
+			return nil, errors.Errorf("$ref %q: expected a path item", ref.Value)
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// parseOpenAPIPermissions разбирает значение x-iam-permissions одной операции
+func parseOpenAPIPermissions(node *yaml.Node, path string) (permissions []string, errs MatrixErrors) {
+	nodes := []*yaml.Node{node}
+	if node.Kind == yaml.SequenceNode {
+		nodes = node.Content
+	}
+	if len(nodes) == 0 {
+		return nil, MatrixErrors{{Line: node.Line, Msg: OpenAPIPermissionsExtension + " must not be empty"}}
+	}
+
+	for _, permissionNode := range nodes {
+		if permissionNode.Kind != yaml.ScalarNode {
+			errs = append(errs, MatrixError{Line: permissionNode.Line, Msg: fmt.Sprintf("%s must be a string or a list of strings", OpenAPIPermissionsExtension)})
+			continue
+		}
+		permission := permissionNode.Value
+		err := validateMatrixRequirement(permission)
+		if err == nil {
+			err = validateRequirementParams(permission, path)
+		}
+		if err != nil {
+			errs = append(errs, MatrixError{Line: permissionNode.Line, Msg: err.Error()})
+			continue
+		}
+		permissions = append(permissions, permission)
+	}
+
+	return permissions, errs
+}
+
+// mappingValue возвращает значение ключа key YAML-маппинга или nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package iam_client
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testOpenAPISpec = `
+openapi: 3.0.3
+info: {title: Categories, version: "1.0"}
+paths:
+  /api/v1/category:
+    parameters: []
+    get:
+      x-iam-permissions: view:category
+    post:
+      summary: Create a category
+  /api/v1/category/{id}:
+    delete:
+      x-iam-permissions: ["edit:category:{id}", "admin & approve"]
+  /api/v2/category:
+    $ref: "#/paths/~1api~1v1~1category"
+  /api/v1/item/{id}:
+    $ref: "#/components/pathItems/Item"
+    put:
+      x-iam-permissions: "edit:item:{id}"
+components:
+  pathItems:
+    Item:
+      get:
+        x-iam-permissions: "view:item:{id}"
+      put:
+        x-iam-permissions: "admin"
+`
+
+func TestParseOpenAPIPermissions(t *testing.T) {
+	got, err := ParseOpenAPIPermissions([]byte(testOpenAPISpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &OpenAPIPermissions{
+		PermissionsMatrix: map[string][]string{
+			"GET/api/v1/category":         {"view:category"},
+			"DELETE/api/v1/category/{id}": {"edit:category:{id}", "admin & approve"},
+			"GET/api/v2/category":         {"view:category"},
+			"GET/api/v1/item/{id}":        {"view:item:{id}"},
+			"PUT/api/v1/item/{id}":        {"edit:item:{id}"},
+		},
+		Operations: []Route{
+			{Method: http.MethodGet, Path: "/api/v1/category"},
+			{Method: http.MethodPost, Path: "/api/v1/category"},
+			{Method: http.MethodDelete, Path: "/api/v1/category/{id}"},
+			{Method: http.MethodGet, Path: "/api/v2/category"},
+			{Method: http.MethodPost, Path: "/api/v2/category"},
+			{Method: http.MethodGet, Path: "/api/v1/item/{id}"},
+			{Method: http.MethodPut, Path: "/api/v1/item/{id}"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseOpenAPIPermissions() = %+v, want %+v", got, want)
+	}
+
+	p := NewPermissionsChecker(got.PermissionsMatrix, nopLogger{})
+	report, err := p.Validate(got, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantUncovered := []Route{{Method: http.MethodPost, Path: "/api/v1/category"}, {Method: http.MethodPost, Path: "/api/v2/category"}}
+	if !reflect.DeepEqual(report.UncoveredRoutes, wantUncovered) || len(report.UnusedRules) > 0 {
+		t.Errorf("Validate() = %+v, want uncovered %v", report, wantUncovered)
+	}
+}
+
+func TestParseOpenAPIPermissions_invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     string
+		wantLine int
+	}{
+		{name: "Swagger 2", spec: "swagger: \"2.0\"\npaths: {}\n", wantLine: 1},
+		{name: "Invalid permission", spec: "openapi: 3.1.0\npaths:\n  /api:\n    get:\n      x-iam-permissions: [\"view:\"]\n", wantLine: 5},
+		{name: "Unknown placeholder", spec: "openapi: 3.1.0\npaths:\n  /api/{id}:\n    get:\n      x-iam-permissions:\n        - view:item:{itemId}\n", wantLine: 6},
+		{name: "Empty list", spec: "openapi: 3.1.0\npaths:\n  /api:\n    get:\n      x-iam-permissions: []\n", wantLine: 5},
+		{name: "External $ref", spec: "openapi: 3.1.0\npaths:\n  /api:\n    $ref: \"items.yaml#/Item\"\n", wantLine: 4},
+		{name: "Unknown $ref", spec: "openapi: 3.1.0\npaths:\n  /api:\n    $ref: \"#/components/pathItems/Item\"\n", wantLine: 4},
+		{name: "Cyclic $ref", spec: "openapi: 3.1.0\npaths:\n  /api:\n    $ref: \"#/paths/~1api\"\n", wantLine: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseOpenAPIPermissions([]byte(tt.spec))
+			var errs MatrixErrors
+			if !errors.As(err, &errs) || errs[0].Line != tt.wantLine {
+				t.Errorf("ParseOpenAPIPermissions() error = %v, want an error at line %d", err, tt.wantLine)
+			}
+		})
+	}
+}
+
+func TestNewPermissionsCheckerFromOpenAPI(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "openapi.yaml")
+	if err := os.WriteFile(path, []byte(testOpenAPISpec), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewPermissionsCheckerFromOpenAPI(path, nopLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &http.Request{Method: http.MethodGet, URL: &url.URL{Path: "/api/v1/item/42"}}
+	if got, want := p.getAllowedPermissions(r), []string{"view:item:{id}"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("getAllowedPermissions() = %v, want %v", got, want)
+	}
+
+	if _, err := NewPermissionsCheckerFromOpenAPI(filepath.Join(t.TempDir(), "missing.yaml"), nopLogger{}); err == nil {
+		t.Error("NewPermissionsCheckerFromOpenAPI() without a file returned no error")
+	}
+}
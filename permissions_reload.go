@@ -0,0 +1,122 @@
+package iam_client
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// snapshot возвращает текущий снимок матрицы доступа
+func (p *PermissionsChecker) snapshot() *matrixSnapshot {
+	if snapshot := p.matrix.Load(); snapshot != nil {
+		return snapshot
+	}
+
+	return &matrixSnapshot{}
+}
+
+// ReplacePermissionsMatrix атомарно заменяет матрицу доступа. Безопасно вызывать одновременно
+// с обработкой запросов: каждый запрос проверяется целиком либо по старой, либо по новой матрице.
+// Если новая матрица не проходит валидацию, старая остается в силе.
+func (p *PermissionsChecker) ReplacePermissionsMatrix(permissionsMatrix map[string][]string) error {
+	if err := ValidatePermissionsMatrix(permissionsMatrix); err != nil {
+		return err
+	}
+
+	snapshot, err := newMatrixSnapshot(permissionsMatrix)
+	if err != nil {
+		return err
+	}
+	p.matrix.Store(snapshot)
+
+	return nil
+}
+
+// ValidatePermissionsMatrix проверяет ключи и права матрицы доступа по тем же правилам, что и LoadPermissionsMatrix
+func ValidatePermissionsMatrix(permissionsMatrix map[string][]string) error {
+	var errs MatrixErrors
+	for key, permissions := range permissionsMatrix {
+		keyErr := validateMatrixKey(key)
+		if keyErr != nil {
+			errs = append(errs, MatrixError{Msg: keyErr.Error()})
+		}
+		if len(permissions) == 0 {
+			errs = append(errs, MatrixError{Msg: "empty permissions for " + key})
+		}
+		for _, permission := range permissions {
+			if err := validateMatrixRequirement(permission); err != nil {
+				errs = append(errs, MatrixError{Msg: key + ": " + err.Error()})
+				continue
+			}
+			if keyErr == nil {
+				if err := validateRequirementParams(permission, key[strings.IndexByte(key, '/'):]); err != nil {
+					errs = append(errs, MatrixError{Msg: key + ": " + err.Error()})
+				}
+			}
+		}
+	}
+
+	return errs.orNil()
+}
+
+// WatchPermissionsFile раз в interval проверяет файл матрицы доступа (время изменения и размер)
+// и при изменении перечитывает его. Если новая матрица не проходит валидацию, старая остается в силе.
+// Работает в отдельной горутине до отмены ctx, события перезагрузки пишутся в лог.
+// Неположительный interval - ошибка, горутина в этом случае не запускается.
+func (p *PermissionsChecker) WatchPermissionsFile(ctx context.Context, path string, interval time.Duration) error {
+	if interval <= 0 {
+		return errors.Errorf("permissions file poll interval must be positive, got %s", interval)
+	}
+
+	var lastModTime time.Time
+	var lastSize int64
+	if info, err := os.Stat(path); err == nil {
+		lastModTime, lastSize = info.ModTime(), info.Size()
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var lastErr string
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				// Пишем в лог только смену ошибки, чтобы не спамить каждый тик
+				if err.Error() != lastErr {
+					p.log.Errorf("sXAzdOYewKSM3WG permissions matrix %s is unavailable, keeping the previous one: %s", path, err)
+					lastErr = err.Error()
+				}
+				continue
+			}
+			if info.ModTime().Equal(lastModTime) && info.Size() == lastSize {
+				continue
+			}
+			lastModTime, lastSize = info.ModTime(), info.Size()
+
+			permissionsMatrix, err := LoadPermissionsMatrix(path)
+			if err == nil {
+				err = p.ReplacePermissionsMatrix(permissionsMatrix)
+			}
+			if err != nil {
+				p.log.Errorf("40LhgSOafyZXfmP invalid permissions matrix %s, keeping the previous one: %s", path, err)
+				lastErr = err.Error()
+				continue
+			}
+
+			lastErr = ""
+			p.log.Infof("permissions matrix reloaded from %s, %d rules", path, len(permissionsMatrix))
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package iam_client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPermissionsChecker_ReplacePermissionsMatrix(t *testing.T) {
+	p := NewPermissionsChecker(map[string][]string{"GET/api/v1/admin/actionLog": {"view:log"}}, nil)
+	r := &http.Request{Method: http.MethodGet, URL: &url.URL{Path: "/api/v1/admin/actionLog"}}
+
+	err := p.ReplacePermissionsMatrix(map[string][]string{"GETT/api/v1/admin/actionLog": {"admin"}})
+	if err == nil {
+		t.Fatal("ReplacePermissionsMatrix() accepted an invalid matrix")
+	}
+	if got := p.getAllowedPermissions(r); !reflect.DeepEqual(got, []string{"view:log"}) {
+		t.Errorf("getAllowedPermissions() after a failed replace = %v, want the previous matrix", got)
+	}
+
+	err = p.ReplacePermissionsMatrix(map[string][]string{"GET/api/v1/admin/actionLog": {"admin"}})
+	if err != nil {
+		t.Fatalf("ReplacePermissionsMatrix() error = %s", err)
+	}
+	if got := p.getAllowedPermissions(r); !reflect.DeepEqual(got, []string{"admin"}) {
+		t.Errorf("getAllowedPermissions() = %v, want %v", got, []string{"admin"})
+	}
+}
+
+func TestPermissionsChecker_WatchPermissionsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "permissions.yaml")
+	writeFile := func(data string) {
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile("rules:\n  - {method: GET, path: /api/v1/admin/actionLog, permissions: [view:log]}\n")
+
+	p, err := NewPermissionsCheckerFromFile(path, nopLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := p.WatchPermissionsFile(ctx, path, 5*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.WatchPermissionsFile(ctx, path, 0); err == nil {
+		t.Error("WatchPermissionsFile() with a zero interval returned no error")
+	}
+
+	r := &http.Request{Method: http.MethodGet, URL: &url.URL{Path: "/api/v1/admin/actionLog"}}
+	waitFor := func(want []string) {
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			if reflect.DeepEqual(p.getAllowedPermissions(r), want) {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatalf("getAllowedPermissions() = %v, want %v", p.getAllowedPermissions(r), want)
+	}
+
+	writeFile("rules:\n  - {method: GET, path: /api/v1/admin/actionLog, permissions: [view:log, admin:log]}\n")
+	waitFor([]string{"view:log", "admin:log"})
+
+	// Битый файл не должен сломать текущую матрицу
+	writeFile("rules:\n  - {method: GETT, path: /api/v1/admin/actionLog, permissions: [admin]}\n")
+	time.Sleep(50 * time.Millisecond)
+	waitFor([]string{"view:log", "admin:log"})
+}
@@ -0,0 +1,215 @@
+package iam_client
+
+import (
+	"net/http"
+	"unsafe"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/mux"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+)
+
+// Require возвращает middleware, которая проверяет права прямо на ручке, без ключа в матрице доступа:
+//
+//	router.Handle("/api/v1/category/{id}", checker.Require("edit:category:{id}")(handler)).Methods("POST")
+//
+// permissions - выражения над правами, объединенные по ИЛИ, как значения матрицы. Плейсхолдеры {name}
+// заполняются параметрами пути из gorilla/mux или chi. Некорректное выражение - ошибка программиста, вызывает панику.
+//
+// Middleware проверяет права целиком сама: пускает по глобальным правилам, а если для ручки есть правило
+// в матрице доступа, требует выполнения и его, и permissions. Поэтому ручки с Require не нуждаются
+// в AuthMiddlewareHandler. Если AuthMiddlewareHandler все же подключен ко всему роутеру gorilla/mux
+// (через router.Use или WithGorillaMuxRouter), он пропускает такие ручки дальше к Require.
+// Для chi такую ручку нужно регистрировать вне группы с AuthMiddlewareHandler.
+func (p *PermissionsChecker) Require(permissions ...string) func(http.Handler) http.Handler {
+	require := mustCompileRequire(permissions)
+	p.recordRequire(require)
+
+	middleware := func(next http.Handler) http.Handler {
+		return &requireHandler{p: p, routeRequirement: require, next: next}
+	}
+	p.recordRequireMiddleware(funcId(middleware))
+
+	return middleware
+}
+
+// EchoRequire - аналог Require для echo. Плейсхолдеры {name} заполняются параметрами пути echo (":name").
+// Ручки с EchoRequire нужно регистрировать вне группы с EchoAuthMiddlewareHandler. Чтобы Validate считал
+// такие ручки покрытыми, роутер echo нужно подключить через WithEchoRouter.
+func (p *PermissionsChecker) EchoRequire(permissions ...string) echo.MiddlewareFunc {
+	require := mustCompileRequire(permissions)
+	p.recordRequire(require)
+
+	middleware := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			params := make([]pathParam, 0, len(c.ParamNames()))
+			for i, name := range c.ParamNames() {
+				params = append(params, pathParam{Name: name, Value: c.ParamValues()[i]})
+			}
+
+			c.SetRequest(p.expandRoles(c.Request()))
+			decision := p.authorize(c.Request(), require, params)
+			p.debugDecision(c.Response(), c.Request(), decision)
+			if !decision.Allowed {
+				return p.echoForbidden(c, decision)
+			}
+			c.SetRequest(p.withSuperPermission(c.Request(), decision))
+			if !decision.passedThrough() {
+				p.echoContextKeys.set(c, c.Request())
+			}
+
+			return next(c)
+		}
+	}
+	p.recordRequireMiddleware(funcId(echo.MiddlewareFunc(middleware)))
+
+	return middleware
+}
+
+// funcId идентификатор значения функции - адрес его замыкания. Функции в Go нельзя сравнить, но middleware
+// из Require и EchoRequire захватывают переменные, поэтому у каждой из них свое замыкание, и по адресу
+// ее можно найти среди middleware ручки, не вызывая их
+func funcId[F any](f F) unsafe.Pointer {
+	return *(*unsafe.Pointer)(unsafe.Pointer(&f))
+}
+
+// recordRequireMiddleware запоминает middleware из Require и EchoRequire, см. isRequireMiddleware
+func (p *PermissionsChecker) recordRequireMiddleware(id unsafe.Pointer) {
+	p.requireMu.Lock()
+	defer p.requireMu.Unlock()
+	if p.requireMiddlewares == nil {
+		p.requireMiddlewares = make(map[unsafe.Pointer]bool)
+	}
+	p.requireMiddlewares[id] = true
+}
+
+// isRequireMiddleware проверяет, что middleware с идентификатором id получена из Require или EchoRequire
+func (p *PermissionsChecker) isRequireMiddleware(id unsafe.Pointer) bool {
+	p.requireMu.Lock()
+	defer p.requireMu.Unlock()
+
+	return p.requireMiddlewares[id]
+}
+
+// WithEchoRouter подключает роутер echo, чтобы Validate знал, какие ручки защищены EchoRequire.
+// Вызывать нужно до регистрации ручек: checker запоминает их через e.OnAddRouteHandler
+// (уже заданный обработчик при этом тоже вызывается).
+func (p *PermissionsChecker) WithEchoRouter(e *echo.Echo) {
+	onAddRoute := e.OnAddRouteHandler
+	e.OnAddRouteHandler = func(host string, route echo.Route, handler echo.HandlerFunc, middlewares []echo.MiddlewareFunc) {
+		if onAddRoute != nil {
+			onAddRoute(host, route, handler, middlewares)
+		}
+		for _, middleware := range middlewares {
+			if p.isRequireMiddleware(funcId(middleware)) {
+				p.recordEchoRequireRoute(echoRoutes([]*echo.Route{&route}))
+				return
+			}
+		}
+	}
+}
+
+func (p *PermissionsChecker) recordEchoRequireRoute(routes []Route) {
+	p.requireMu.Lock()
+	defer p.requireMu.Unlock()
+	if p.echoRequireRoutes == nil {
+		p.echoRequireRoutes = make(map[Route]bool)
+	}
+	for _, route := range routes {
+		p.echoRequireRoutes[route] = true
+	}
+}
+
+func (p *PermissionsChecker) isEchoRequireRoute(route Route) bool {
+	p.requireMu.Lock()
+	defer p.requireMu.Unlock()
+
+	return p.echoRequireRoutes[route]
+}
+
+// routeRequirement права, заданные на ручке через Require
+type routeRequirement struct {
+	permissions []string
+	requirement *requirement
+}
+
+func mustCompileRequire(permissions []string) *routeRequirement {
+	if len(permissions) == 0 {
+		panic("iam_client: Require without permissions")
+	}
+
+	req, err := compileRequirement(permissions)
+	if err != nil {
+		panic(errors.Wrap(err, "iam_client: Require"))
+	}
+
+	return &routeRequirement{permissions: permissions, requirement: req}
+}
+
+// requireHandler обработчик, обернутый Require. По его типу AuthMiddlewareHandler узнает,
+// что ручка проверяет права сама
+type requireHandler struct {
+	*routeRequirement
+	p    *PermissionsChecker
+	next http.Handler
+}
+
+func (h *requireHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r = h.p.expandRoles(r)
+	decision := h.p.authorize(r, h.routeRequirement, routeParams(r))
+	h.p.debugDecision(w, r, decision)
+	if !decision.Allowed {
+		h.p.forbidden(w, r, decision)
+		return
+	}
+
+	h.next.ServeHTTP(w, h.p.withSuperPermission(r, decision))
+}
+
+// routeParams возвращает параметры пути, найденные роутером gorilla/mux или chi
+func routeParams(r *http.Request) []pathParam {
+	if vars := mux.Vars(r); len(vars) > 0 {
+		return varsParams(vars)
+	}
+
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		params := make([]pathParam, 0, len(rctx.URLParams.Keys))
+		for i, name := range rctx.URLParams.Keys {
+			params = append(params, pathParam{Name: name, Value: rctx.URLParams.Values[i]})
+		}
+		return params
+	}
+
+	return nil
+}
+
+func varsParams(vars map[string]string) []pathParam {
+	params := make([]pathParam, 0, len(vars))
+	for name, value := range vars {
+		params = append(params, pathParam{Name: name, Value: value})
+	}
+
+	return params
+}
+
+// routeRequireHandler возвращает обработчик Require, если ручка gorilla/mux им обернута, и параметры ее пути
+func (p *PermissionsChecker) routeRequireHandler(r *http.Request) (*requireHandler, []pathParam) {
+	route, vars := mux.CurrentRoute(r), mux.Vars(r)
+	if route == nil && p.gorillaMuxRouter != nil {
+		var match mux.RouteMatch
+		if p.gorillaMuxRouter.Match(r, &match) {
+			route, vars = match.Route, match.Vars
+		}
+	}
+	if route == nil {
+		return nil, nil
+	}
+
+	handler, ok := route.GetHandler().(*requireHandler)
+	if !ok {
+		return nil, nil
+	}
+
+	return handler, varsParams(vars)
+}
@@ -0,0 +1,135 @@
+package iam_client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/labstack/echo/v4"
+)
+
+func TestPermissionsChecker_Require(t *testing.T) {
+	p := NewPermissionsChecker(map[string][]string{
+		"DELETE/api/v1/category/{id}": {"admin"},
+	}, nopLogger{})
+
+	ok := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	router := mux.NewRouter()
+	router.Use(p.AuthMiddlewareHandler)
+	router.Handle("/api/v1/category/{id}", p.Require("edit:category:{id}")(ok)).Methods(http.MethodPost, http.MethodDelete)
+	router.Handle("/api/v1/unprotected", ok)
+
+	tests := []struct {
+		name            string
+		method          string
+		path            string
+		userPermissions []string
+		wantStatus      int
+	}{
+		{
+			name:            "Route requirement without a matrix rule",
+			method:          http.MethodPost,
+			path:            "/api/v1/category/42",
+			userPermissions: []string{"edit:category:42"},
+			wantStatus:      http.StatusOK,
+		},
+
+		{
+			name:            "Route requirement is not met",
+			method:          http.MethodPost,
+			path:            "/api/v1/category/43",
+			userPermissions: []string{"edit:category:42"},
+			wantStatus:      http.StatusForbidden,
+		},
+
+		{
+			name:            "Matrix rule is required as well",
+			method:          http.MethodDelete,
+			path:            "/api/v1/category/42",
+			userPermissions: []string{"edit:category:42"},
+			wantStatus:      http.StatusForbidden,
+		},
+
+		{
+			name:            "Matrix rule and route requirement are met",
+			method:          http.MethodDelete,
+			path:            "/api/v1/category/42",
+			userPermissions: []string{"edit:category:42", "admin:category"},
+			wantStatus:      http.StatusOK,
+		},
+
+		{
+			name:            "Global rule",
+			method:          http.MethodPost,
+			path:            "/api/v1/category/42",
+			userPermissions: []string{"admin:*"},
+			wantStatus:      http.StatusOK,
+		},
+
+		{
+			name:            "Route without Require is still checked by the matrix",
+			method:          http.MethodGet,
+			path:            "/api/v1/unprotected",
+			userPermissions: []string{"edit:category:42"},
+			wantStatus:      http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			r = r.WithContext(context.WithValue(r.Context(), CtxIamPermissions{}, tt.userPermissions))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %v, want %v", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestPermissionsChecker_EchoRequire(t *testing.T) {
+	p := NewPermissionsChecker(nil, nopLogger{})
+
+	e := echo.New()
+	e.POST("/api/v1/category/:id", func(c echo.Context) error {
+		return c.String(http.StatusOK, EchoGetUserId(c))
+	}, p.EchoRequire("edit:category:{id}"))
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+	}{
+		{name: "Parameter from the echo route", path: "/api/v1/category/42", wantStatus: http.StatusOK},
+		{name: "Another resource", path: "/api/v1/category/43", wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tt.path, nil)
+			ctx := context.WithValue(r.Context(), CtxIamPermissions{}, []string{"edit:category:42"})
+			ctx = context.WithValue(ctx, CtxIamUserId{}, "some_user")
+			w := httptest.NewRecorder()
+			e.ServeHTTP(w, r.WithContext(ctx))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && w.Body.String() != "some_user" {
+				t.Errorf("user id = %q, want %q", w.Body.String(), "some_user")
+			}
+		})
+	}
+}
+
+func TestPermissionsChecker_RequireInvalid(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Require() with an invalid expression did not panic")
+		}
+	}()
+
+	NewPermissionsChecker(nil, nopLogger{}).Require("edit:category & (")
+}
@@ -0,0 +1,386 @@
+package iam_client
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Каждый элемент списка разрешенных прав в матрице - это выражение над правами:
+//
+//	edit:category & (approve:* | admin)
+//
+// "&" - И, "|" - ИЛИ, скобки группируют, "&" связывает сильнее "|". Элементы списка объединяются по ИЛИ,
+// т.е. []string{"view:log", "admin"} - это то же самое, что []string{"view:log | admin"}.
+// Выражения разбираются один раз при создании PermissionsChecker (или замене матрицы).
+//
+// Сегмент скоупа может быть плейсхолдером параметра пути: для ключа "POST/api/v1/category/{id}"
+// право "edit:category:{id}" на запросе к /api/v1/category/42 превращается в "edit:category:42".
+
+type requirementOp int
+
+const (
+	requirementPermission requirementOp = iota
+	requirementAll
+	requirementAny
+)
+
+// requirement скомпилированное требование к правам пользователя
+type requirement struct {
+	op requirementOp
+	// permission право для requirementPermission, segments - оно же, разбитое по ":"
+	permission string
+	segments   []string
+	// bound право содержит плейсхолдеры параметров пути
+	bound bool
+	// children подвыражения для requirementAll и requirementAny
+	children []*requirement
+}
+
+// compileRequirement разбирает список разрешенных прав из матрицы в одно требование "любое из"
+func compileRequirement(allowedPermissions []string) (*requirement, error) {
+	req := &requirement{op: requirementAny}
+	for _, expr := range allowedPermissions {
+		child, err := parseRequirement(expr)
+		if err != nil {
+			return nil, err
+		}
+		req.children = append(req.children, child)
+	}
+
+	return req, nil
+}
+
+// legacyRequirement требование "любое из" для списка прав, который не разбирается как выражения.
+// Права не разбираются: "&", "|", скобки и плейсхолдеры в них - обычные символы
+func legacyRequirement(allowedPermissions []string) *requirement {
+	req := &requirement{op: requirementAny}
+	for _, permission := range allowedPermissions {
+		req.children = append(req.children, &requirement{
+			op:         requirementPermission,
+			permission: permission,
+			segments:   strings.Split(permission, ":"),
+		})
+	}
+
+	return req
+}
+
+// parseRequirement разбирает одно выражение над правами
+func parseRequirement(expr string) (*requirement, error) {
+	parser := requirementParser{tokens: tokenizeRequirement(expr)}
+	req, err := parser.parseAny()
+	if err != nil {
+		return nil, errors.Wrapf(err, "permission expression %q", expr)
+	}
+	if parser.pos < len(parser.tokens) {
+		return nil, errors.Errorf("permission expression %q: unexpected %q", expr, parser.tokens[parser.pos])
+	}
+
+	return req, nil
+}
+
+// eval проверяет требование на правах пользователя. params - параметры пути, которыми заполняются плейсхолдеры
+func (req *requirement) eval(index *permissionIndex, params []pathParam) bool {
+	return req.evalGranted(index, params, nil)
+}
+
+// evalGranted - eval, который дописывает в granted (если он не nil) права пользователя, давшие доступ.
+// Без granted и плейсхолдеров с числом сегментов больше maxStackSegments память не выделяет
+func (req *requirement) evalGranted(index *permissionIndex, params []pathParam, granted *[]string) bool {
+	switch req.op {
+	case requirementAll:
+		for _, child := range req.children {
+			if !child.evalGranted(index, params, granted) {
+				return false
+			}
+		}
+		return len(req.children) > 0
+
+	case requirementAny:
+		for _, child := range req.children {
+			mark := 0
+			if granted != nil {
+				mark = len(*granted)
+			}
+			if child.evalGranted(index, params, granted) {
+				return true
+			}
+			if granted != nil {
+				// Ветка не выполнилась целиком, права из нее доступ не дали
+				*granted = (*granted)[:mark]
+			}
+		}
+		return false
+
+	default:
+		required := req.segments
+		if req.bound {
+			var segmentsBuf [maxStackSegments]string
+			bound := append(segmentsBuf[:0], req.segments...)
+			if !bindSegments(bound, params) {
+				return false
+			}
+			required = bound
+		}
+
+		userPermission, found := index.grantedBy(required)
+		if found && granted != nil {
+			*granted = append(*granted, userPermission)
+		}
+		return found
+	}
+}
+
+// missing дописывает в result права из требования, которых не хватило пользователю: невыполненные
+// права И, а для ИЛИ - невыполненные права всех веток. Плейсхолдеры заполняются параметрами пути,
+// если это возможно
+func (req *requirement) missing(index *permissionIndex, params []pathParam, result *[]string) {
+	switch req.op {
+	case requirementAll, requirementAny:
+		if req.eval(index, params) {
+			return
+		}
+		for _, child := range req.children {
+			child.missing(index, params, result)
+		}
+
+	default:
+		if req.eval(index, params) {
+			return
+		}
+		permission := req.permission
+		if req.bound {
+			bound := append([]string(nil), req.segments...)
+			if bindSegments(bound, params) {
+				permission = strings.Join(bound, ":")
+			}
+		}
+		*result = append(*result, permission)
+	}
+}
+
+// hasPlaceholders проверяет, что для требования нужны параметры пути
+func (req *requirement) hasPlaceholders() bool {
+	if req.op == requirementPermission {
+		return req.bound
+	}
+
+	for _, child := range req.children {
+		if child.hasPlaceholders() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// permissions возвращает все права, упомянутые в требовании
+func (req *requirement) permissions() []string {
+	if req.op == requirementPermission {
+		return []string{req.permission}
+	}
+
+	var result []string
+	for _, child := range req.children {
+		result = append(result, child.permissions()...)
+	}
+
+	return result
+}
+
+func tokenizeRequirement(expr string) []string {
+	var tokens []string
+	start := -1
+	for i, ch := range expr {
+		switch ch {
+		case '&', '|', '(', ')', ' ', '\t':
+			if start >= 0 {
+				tokens = append(tokens, expr[start:i])
+				start = -1
+			}
+			if ch != ' ' && ch != '\t' {
+				tokens = append(tokens, string(ch))
+			}
+		default:
+			if start < 0 {
+				start = i
+			}
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, expr[start:])
+	}
+
+	return tokens
+}
+
+type requirementParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *requirementParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+
+	return ""
+}
+
+// parseAny: and ('|' and)*
+func (p *requirementParser) parseAny() (*requirement, error) {
+	return p.parseList(requirementAny, "|", p.parseAll)
+}
+
+// parseAll: unary ('&' unary)*
+func (p *requirementParser) parseAll() (*requirement, error) {
+	return p.parseList(requirementAll, "&", p.parseUnary)
+}
+
+func (p *requirementParser) parseList(op requirementOp, separator string, parseChild func() (*requirement, error)) (*requirement, error) {
+	first, err := parseChild()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() != separator {
+		return first, nil
+	}
+
+	req := &requirement{op: op, children: []*requirement{first}}
+	for p.peek() == separator {
+		p.pos++
+		child, err := parseChild()
+		if err != nil {
+			return nil, err
+		}
+		req.children = append(req.children, child)
+	}
+
+	return req, nil
+}
+
+// parseUnary: '(' any ')' | permission
+func (p *requirementParser) parseUnary() (*requirement, error) {
+	token := p.peek()
+	switch token {
+	case "":
+		return nil, errors.New("unexpected end of expression")
+
+	case "(":
+		p.pos++
+		req, err := p.parseAny()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, errors.New("missing \")\"")
+		}
+		p.pos++
+		return req, nil
+
+	case ")", "&", "|":
+		return nil, errors.Errorf("unexpected %q", token)
+	}
+
+	p.pos++
+	if err := validateMatrixPermission(token); err != nil {
+		return nil, err
+	}
+
+	return &requirement{
+		op:         requirementPermission,
+		permission: token,
+		segments:   strings.Split(token, ":"),
+		bound:      strings.Contains(token, "{"),
+	}, nil
+}
+
+// validateMatrixRequirement проверяет выражение над правами из матрицы.
+// Ошибки синтаксиса отдельных прав возвращаются как есть.
+func validateMatrixRequirement(expr string) error {
+	if !strings.ContainsAny(expr, "&|() \t") {
+		return validateMatrixPermission(expr)
+	}
+
+	_, err := parseRequirement(expr)
+	return err
+}
+
+// bindSegments заменяет плейсхолдеры {name} в сегментах скоупа значениями параметров пути.
+// Если параметра нет, он пустой, равен "*" или содержит ":", право не может быть выдано:
+// иначе значение из URL могло бы расширить требуемый скоуп
+func bindSegments(segments []string, params []pathParam) bool {
+	for i := 1; i < len(segments); i++ {
+		name, isPlaceholder := placeholderName(segments[i])
+		if !isPlaceholder {
+			continue
+		}
+
+		value, found := "", false
+		for _, param := range params {
+			if param.Name == name {
+				value, found = param.Value, true
+				break
+			}
+		}
+		if !found || value == "" || value == "*" || strings.Contains(value, ":") {
+			return false
+		}
+		segments[i] = value
+	}
+
+	return true
+}
+
+func placeholderName(segment string) (string, bool) {
+	if len(segment) > 2 && segment[0] == '{' && segment[len(segment)-1] == '}' {
+		return segment[1 : len(segment)-1], true
+	}
+
+	return "", false
+}
+
+// validateRequirementParams проверяет, что все плейсхолдеры в выражении над правами есть среди параметров пути
+func validateRequirementParams(expr, path string) error {
+	if !strings.Contains(expr, "{") {
+		return nil
+	}
+
+	req, err := parseRequirement(expr)
+	if err != nil {
+		return err
+	}
+
+	pathParams := matrixPathParams(path)
+	for _, permission := range req.permissions() {
+		for _, segment := range strings.Split(permission, ":")[1:] {
+			if name, isPlaceholder := placeholderName(segment); isPlaceholder && !InArray(pathParams, name) {
+				return errors.Errorf("permission %q: path %s has no parameter {%s}", permission, path, name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// matrixPathParams возвращает имена макросов пути из матрицы
+func matrixPathParams(path string) []string {
+	var names []string
+	for _, segment := range splitPath(path) {
+		if !strings.Contains(segment, "{") {
+			continue
+		}
+		re, err := compileSegment(segment)
+		if err != nil {
+			continue
+		}
+		for _, name := range re.SubexpNames() {
+			if name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+
+	return names
+}
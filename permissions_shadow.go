@@ -0,0 +1,107 @@
+package iam_client
+
+import (
+	"net/http"
+	"strings"
+)
+
+// EnforcementMode режим применения решений о доступе
+type EnforcementMode int
+
+const (
+	// EnforcementEnforce отказ в доступе отдается клиенту как 403 (по умолчанию)
+	EnforcementEnforce EnforcementMode = iota
+	// EnforcementShadow матрица проверяется, но запрос пропускается всегда. Отказы, которые были бы
+	// в режиме EnforcementEnforce, пишутся в лог и передаются в хук WithShadowHook
+	EnforcementShadow
+)
+
+// ShadowDenial отказ в доступе, не примененный из-за режима EnforcementShadow
+type ShadowDenial struct {
+	Method string
+	Path   string
+	// Key ключ матрицы доступа, пустой, если правило в матрице не найдено
+	Key    string
+	UserId string
+	// Missing права, которых не хватило пользователю, см. Decision.Missing
+	Missing  []string
+	Decision Decision
+}
+
+// ShadowHook получает отказы, не примененные в режиме EnforcementShadow. Вызывается синхронно
+// в middleware, поэтому не должен блокироваться надолго.
+type ShadowHook func(r *http.Request, denial ShadowDenial)
+
+// WithEnforcementMode задает режим применения решений для всех ручек. Режим EnforcementShadow
+// позволяет перевести сервис на строгую матрицу, сначала собрав отказы, которые она дала бы.
+func (p *PermissionsChecker) WithEnforcementMode(mode EnforcementMode) {
+	p.enforcementMode = mode
+}
+
+// WithRouteEnforcement задает режим для отдельных правил матрицы по их ключам, например,
+// "GET/api/v1/category/{id}". Так можно ужесточать доступ постепенно: включить EnforcementShadow
+// для всего сервиса и EnforcementEnforce для уже проверенных ручек, или наоборот.
+// Ручки без правила в матрице (в т.ч. защищенные только Require) подчиняются WithEnforcementMode.
+// Повторный вызов дополняет уже заданные ключи.
+func (p *PermissionsChecker) WithRouteEnforcement(mode EnforcementMode, keys ...string) error {
+	var errs MatrixErrors
+	for _, key := range keys {
+		if err := validateMatrixKey(key); err != nil {
+			errs = append(errs, MatrixError{Msg: err.Error()})
+		}
+	}
+	if err := errs.orNil(); err != nil {
+		return err
+	}
+
+	if p.routeEnforcement == nil {
+		p.routeEnforcement = make(map[string]EnforcementMode, len(keys))
+	}
+	for _, key := range keys {
+		p.routeEnforcement[key] = mode
+	}
+
+	return nil
+}
+
+// WithShadowHook задает хук для отказов, не примененных в режиме EnforcementShadow
+func (p *PermissionsChecker) WithShadowHook(hook ShadowHook) {
+	p.shadowHook = hook
+}
+
+// enforcement возвращает режим для правила матрицы с ключом key
+func (p *PermissionsChecker) enforcement(key string) EnforcementMode {
+	if mode, found := p.routeEnforcement[key]; found {
+		return mode
+	}
+
+	return p.enforcementMode
+}
+
+// shadowed проверяет, что отказ decision не применяется, и тогда помечает решение как Shadowed
+func (p *PermissionsChecker) shadowed(decision *Decision) bool {
+	if decision.Allowed || p.enforcement(decision.Key) != EnforcementShadow {
+		return false
+	}
+
+	decision.Allowed, decision.Shadowed = true, true
+	return true
+}
+
+// reportShadowDenial пишет непримененный отказ в лог и передает его в хук
+func (p *PermissionsChecker) reportShadowDenial(r *http.Request, decision Decision) {
+	denial := ShadowDenial{
+		Method:   r.Method,
+		Path:     r.URL.Path,
+		Key:      decision.Key,
+		UserId:   GetUserId(r.Context()),
+		Missing:  decision.Missing,
+		Decision: decision,
+	}
+
+	p.log.Warningf("Ht6wQv2LpZr8mKc shadow permissions denial %s %s user=%s key=%s missing=%s reason=%s",
+		denial.Method, denial.Path, denial.UserId, denial.Key, strings.Join(denial.Missing, ","), decision.Reason)
+	if p.shadowHook != nil {
+		p.shadowHook(r, denial)
+	}
+}
@@ -0,0 +1,133 @@
+package iam_client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestPermissionsChecker_WithEnforcementMode(t *testing.T) {
+	permissionsMatrix := map[string][]string{
+		"GET/api/v1/category/{id}":    {"view:category"},
+		"DELETE/api/v1/category/{id}": {"edit:category:{id} & approve"},
+	}
+
+	tests := []struct {
+		name        string
+		mode        EnforcementMode
+		routeMode   EnforcementMode
+		routeKeys   []string
+		method      string
+		path        string
+		wantStatus  int
+		wantDenials []ShadowDenial
+	}{
+		{
+			name:       "Enforce",
+			mode:       EnforcementEnforce,
+			method:     http.MethodDelete,
+			path:       "/api/v1/category/42",
+			wantStatus: http.StatusForbidden,
+		},
+
+		{
+			name:       "Shadow",
+			mode:       EnforcementShadow,
+			method:     http.MethodDelete,
+			path:       "/api/v1/category/42",
+			wantStatus: http.StatusOK,
+			wantDenials: []ShadowDenial{{
+				Method:  http.MethodDelete,
+				Path:    "/api/v1/category/42",
+				Key:     "DELETE/api/v1/category/{id}",
+				UserId:  "some_user",
+				Missing: []string{"edit:category:42"},
+			}},
+		},
+
+		{
+			name:       "Shadow, allowed",
+			mode:       EnforcementShadow,
+			method:     http.MethodGet,
+			path:       "/api/v1/category/42",
+			wantStatus: http.StatusOK,
+		},
+
+		{
+			name:       "Shadow, route without a rule",
+			mode:       EnforcementShadow,
+			method:     http.MethodPut,
+			path:       "/api/v1/category/42",
+			wantStatus: http.StatusOK,
+			wantDenials: []ShadowDenial{{
+				Method: http.MethodPut,
+				Path:   "/api/v1/category/42",
+				UserId: "some_user",
+			}},
+		},
+
+		{
+			name:       "Shadow, enforced route",
+			mode:       EnforcementShadow,
+			routeMode:  EnforcementEnforce,
+			routeKeys:  []string{"DELETE/api/v1/category/{id}"},
+			method:     http.MethodDelete,
+			path:       "/api/v1/category/42",
+			wantStatus: http.StatusForbidden,
+		},
+
+		{
+			name:       "Enforce, shadowed route",
+			mode:       EnforcementEnforce,
+			routeMode:  EnforcementShadow,
+			routeKeys:  []string{"DELETE/api/v1/category/{id}"},
+			method:     http.MethodDelete,
+			path:       "/api/v1/category/42",
+			wantStatus: http.StatusOK,
+			wantDenials: []ShadowDenial{{
+				Method:  http.MethodDelete,
+				Path:    "/api/v1/category/42",
+				Key:     "DELETE/api/v1/category/{id}",
+				UserId:  "some_user",
+				Missing: []string{"edit:category:42"},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPermissionsChecker(permissionsMatrix, nopLogger{})
+			p.WithEnforcementMode(tt.mode)
+			if err := p.WithRouteEnforcement(tt.routeMode, tt.routeKeys...); err != nil {
+				t.Fatal(err)
+			}
+			var gotDenials []ShadowDenial
+			p.WithShadowHook(func(_ *http.Request, denial ShadowDenial) {
+				denial.Decision = Decision{}
+				gotDenials = append(gotDenials, denial)
+			})
+			handler := p.AuthMiddlewareHandler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			ctx := context.WithValue(r.Context(), CtxIamPermissions{}, []string{"view:category", "approve"})
+			r = r.WithContext(context.WithValue(ctx, CtxIamUserId{}, "some_user"))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if !reflect.DeepEqual(gotDenials, tt.wantDenials) {
+				t.Errorf("shadow denials = %+v, want %+v", gotDenials, tt.wantDenials)
+			}
+		})
+	}
+}
+
+func TestPermissionsChecker_WithRouteEnforcement_invalid(t *testing.T) {
+	p := NewPermissionsChecker(nil, nopLogger{})
+	if err := p.WithRouteEnforcement(EnforcementShadow, "GETT/api/v1/category"); err == nil {
+		t.Error("WithRouteEnforcement() with an invalid key returned no error")
+	}
+}
@@ -1,16 +1,19 @@
 package iam_client
 
 import (
+	"context"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"reflect"
 	"testing"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/gorilla/mux"
+	"github.com/labstack/echo/v4"
 )
 
-func TestPermissionsChecker_checkUserPermission(t *testing.T) {
+func Test_requirement_eval(t *testing.T) {
 	type args struct {
 		allowedPermissions []string
 		userPermissions    []string
@@ -100,12 +103,99 @@ func TestPermissionsChecker_checkUserPermission(t *testing.T) {
 			},
 			want: false,
 		},
+
+		{
+			name: "AND expression, has all permissions",
+			args: args{
+				allowedPermissions: []string{"edit:category & approve:*"},
+				userPermissions:    []string{"edit:category", "approve:*"},
+			},
+			want: true,
+		},
+
+		{
+			name: "AND expression, lacks one permission",
+			args: args{
+				allowedPermissions: []string{"edit:category & approve:*"},
+				userPermissions:    []string{"edit:category", "approve:promo"},
+			},
+			want: false,
+		},
+
+		{
+			name: "AND binds tighter than OR",
+			args: args{
+				allowedPermissions: []string{"edit:category & approve:* | admin"},
+				userPermissions:    []string{"admin:log"},
+			},
+			want: true,
+		},
+
+		{
+			name: "Parentheses group an OR",
+			args: args{
+				allowedPermissions: []string{"edit:category & (approve:* | admin)"},
+				userPermissions:    []string{"admin:log"},
+			},
+			want: false,
+		},
+
+		{
+			name: "List elements are OR'ed with expressions",
+			args: args{
+				allowedPermissions: []string{"edit:category & approve:*", "view:log"},
+				userPermissions:    []string{"view:log"},
+			},
+			want: true,
+		},
+
+		{
+			name: "Invalid expression denies",
+			args: args{
+				allowedPermissions: []string{"edit:category & (approve:*"},
+				userPermissions:    []string{"edit:category", "approve:*"},
+			},
+			want: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			p := &PermissionsChecker{}
-			if got := p.checkUserPermission(tt.args.allowedPermissions, tt.args.userPermissions); got != tt.want {
-				t.Errorf("checkUserPermission() = %v, want %v", got, tt.want)
+			req, err := compileRequirement(tt.args.allowedPermissions)
+			index := newPermissionIndex(tt.args.userPermissions)
+			if got := err == nil && req.eval(&index, nil); got != tt.want {
+				t.Errorf("compileRequirement(%q).eval() = %v, want %v", tt.args.allowedPermissions, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_permissionGranted(t *testing.T) {
+	tests := []struct {
+		name           string
+		required       string
+		userPermission string
+		want           bool
+	}{
+		{name: "Exact match", required: "edit:category:123", userPermission: "edit:category:123", want: true},
+		{name: "Different base", required: "edit:category:123", userPermission: "view:category:123", want: false},
+		{name: "Different scope", required: "edit:category:123", userPermission: "edit:category:456", want: false},
+		{name: "Wildcard at the last level", required: "edit:category:123", userPermission: "edit:category:*", want: true},
+		{name: "Wildcard at a middle level", required: "edit:category:123", userPermission: "edit:*:123", want: true},
+		{name: "Wildcard at a middle level, different scope", required: "edit:category:123", userPermission: "edit:*:456", want: false},
+		{name: "Wildcard does not replace the base", required: "edit:category", userPermission: "*:category", want: false},
+		{name: "Bare base grants everything below", required: "edit:category:123", userPermission: "edit", want: true},
+		{name: "Shorter permission grants everything below", required: "edit:category:123", userPermission: "edit:category", want: true},
+		{name: "Required wildcard needs a user wildcard", required: "edit:category:*", userPermission: "edit:category:123", want: false},
+		{name: "Required wildcard, user wildcard", required: "edit:category:*", userPermission: "edit:category:*", want: true},
+		{name: "Required wildcard, user wildcard above", required: "edit:category:*", userPermission: "edit:*", want: true},
+		{name: "Required without a deeper scope accepts any deeper scope", required: "view:log", userPermission: "view:log:billing", want: true},
+		{name: "Bare required base accepts any scope", required: "view", userPermission: "view:log:billing", want: true},
+		{name: "Prefix of a segment is not a match", required: "edit:cat", userPermission: "edit:category", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := permissionGranted(tt.required, tt.userPermission); got != tt.want {
+				t.Errorf("permissionGranted(%q, %q) = %v, want %v", tt.required, tt.userPermission, got, tt.want)
 			}
 		})
 	}
@@ -170,7 +260,7 @@ func TestPermissionsChecker_getAllowedPermissionsWithGorillaMuxRouter(t *testing
 		},
 
 		{
-			name: "Complex path with some permissions without mux router (won't detect a path with curly brackets)",
+			name: "Complex path with some permissions without mux router (detected by the built-in matcher)",
 			permissionsMatrix: map[string][]string{
 				"POST/api/v1/admin/auth-services/{id}/activate": []string{"admin:activate"},
 				"GET/api/v1/admin/auth-services":                []string{"admin"},
@@ -180,7 +270,7 @@ func TestPermissionsChecker_getAllowedPermissionsWithGorillaMuxRouter(t *testing
 				method: "POST",
 				path:   "/api/v1/admin/auth-services/123/activate",
 			},
-			want: nil,
+			want: []string{"admin:activate"},
 		},
 	}
 	for _, tt := range tests {
@@ -258,7 +348,7 @@ func TestPermissionsChecker_getAllowedPermissionsWithChiMuxRouter(t *testing.T)
 		},
 
 		{
-			name: "Complex path with some permissions without mux router (won't detect a path with curly brackets)",
+			name: "Complex path with some permissions without mux router (detected by the built-in matcher)",
 			permissionsMatrix: map[string][]string{
 				"POST/api/v1/admin/auth-services/{id}/activate": []string{"admin:activate"},
 				"GET/api/v1/admin/auth-services":                []string{"admin"},
@@ -268,7 +358,7 @@ func TestPermissionsChecker_getAllowedPermissionsWithChiMuxRouter(t *testing.T)
 				method: "POST",
 				path:   "/api/v1/admin/auth-services/123/activate",
 			},
-			want: nil,
+			want: []string{"admin:activate"},
 		},
 	}
 	for _, tt := range tests {
@@ -286,3 +376,454 @@ func TestPermissionsChecker_getAllowedPermissionsWithChiMuxRouter(t *testing.T)
 		})
 	}
 }
+
+func TestPermissionsChecker_getAllowedPermissionsMethods(t *testing.T) {
+	permissionsMatrix := map[string][]string{
+		"GET/api/v1/category":        {"view:category"},
+		"ANY/api/v1/category":        {"admin"},
+		"PUT|PATCH/api/v1/category":  {"edit:category"},
+		"PATCH/api/v1/category":      {"edit:patch"},
+		"HEAD|OPTIONS/api/v1/health": {"view:health"},
+		"ANY/api/v1/health":          {"admin"},
+		"ANY/api/v1/hook":            {"hook"},
+	}
+
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		optionsPolicy OptionsPolicy
+		want          []string
+	}{
+		{
+			name:   "Exact method",
+			method: http.MethodGet,
+			path:   "/api/v1/category",
+			want:   []string{"view:category"},
+		},
+
+		{
+			name:   "HEAD falls back to GET before ANY",
+			method: http.MethodHead,
+			path:   "/api/v1/category",
+			want:   []string{"view:category"},
+		},
+
+		{
+			name:   "Method list",
+			method: http.MethodPut,
+			path:   "/api/v1/category",
+			want:   []string{"edit:category"},
+		},
+
+		{
+			name:   "Exact method beats a method list",
+			method: http.MethodPatch,
+			path:   "/api/v1/category",
+			want:   []string{"edit:patch"},
+		},
+
+		{
+			name:   "ANY",
+			method: http.MethodDelete,
+			path:   "/api/v1/category",
+			want:   []string{"admin"},
+		},
+
+		{
+			name:   "HEAD in a method list beats GET fallback",
+			method: http.MethodHead,
+			path:   "/api/v1/health",
+			want:   []string{"view:health"},
+		},
+
+		{
+			name:   "OPTIONS is covered by ANY",
+			method: http.MethodOptions,
+			path:   "/api/v1/hook",
+			want:   []string{"hook"},
+		},
+
+		{
+			name:          "OPTIONS is not covered by ANY with OptionsExplicitOnly",
+			method:        http.MethodOptions,
+			path:          "/api/v1/hook",
+			optionsPolicy: OptionsExplicitOnly,
+			want:          nil,
+		},
+
+		{
+			name:          "Explicit OPTIONS with OptionsExplicitOnly",
+			method:        http.MethodOptions,
+			path:          "/api/v1/health",
+			optionsPolicy: OptionsExplicitOnly,
+			want:          []string{"view:health"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPermissionsChecker(permissionsMatrix, nil)
+			p.WithOptionsPolicy(tt.optionsPolicy)
+			r := http.Request{
+				Method: tt.method,
+				URL:    &url.URL{Path: tt.path},
+			}
+
+			if got := p.getAllowedPermissions(&r); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getAllowedPermissions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPermissionsChecker_globalRules(t *testing.T) {
+	permissionsMatrix := map[string][]string{
+		"GET/api/v1/salary/{id}": {"view:salary"},
+	}
+
+	tests := []struct {
+		name            string
+		globalRules     []GlobalRule
+		method          string
+		path            string
+		userPermissions []string
+		wantStatus      int
+	}{
+		{
+			name:            "Default rules, admin:* passes everywhere",
+			method:          http.MethodDelete,
+			path:            "/api/v1/category/1",
+			userPermissions: []string{"admin:*"},
+			wantStatus:      http.StatusOK,
+		},
+
+		{
+			name:            "Default rules, view:* passes HEAD",
+			method:          http.MethodHead,
+			path:            "/api/v1/category/1",
+			userPermissions: []string{"view:*"},
+			wantStatus:      http.StatusOK,
+		},
+
+		{
+			name:            "Default rules, view:* does not pass POST",
+			method:          http.MethodPost,
+			path:            "/api/v1/category/1",
+			userPermissions: []string{"view:*"},
+			wantStatus:      http.StatusForbidden,
+		},
+
+		{
+			name: "Excluded path falls back to the matrix",
+			globalRules: []GlobalRule{
+				{Permission: "view:*", Methods: []string{http.MethodGet}, ExcludePaths: []string{"/api/v1/salary/**"}},
+			},
+			method:          http.MethodGet,
+			path:            "/api/v1/salary/1",
+			userPermissions: []string{"view:*"},
+			wantStatus:      http.StatusForbidden,
+		},
+
+		{
+			name: "Excluded path, explicit permission from the matrix",
+			globalRules: []GlobalRule{
+				{Permission: "view:*", Methods: []string{http.MethodGet}, ExcludePaths: []string{"/api/v1/salary/**"}},
+			},
+			method:          http.MethodGet,
+			path:            "/api/v1/salary/1",
+			userPermissions: []string{"view:*", "view:salary"},
+			wantStatus:      http.StatusOK,
+		},
+
+		{
+			name: "Own global role",
+			globalRules: []GlobalRule{
+				{Permission: "support:*", Methods: []string{http.MethodGet, http.MethodPost}},
+			},
+			method:          http.MethodPost,
+			path:            "/api/v1/category/1",
+			userPermissions: []string{"support:*"},
+			wantStatus:      http.StatusOK,
+		},
+
+		{
+			name: "Methods as a list",
+			globalRules: []GlobalRule{
+				{Permission: "support:*", Methods: []string{"get|post"}},
+			},
+			method:          http.MethodPost,
+			path:            "/api/v1/category/1",
+			userPermissions: []string{"support:*"},
+			wantStatus:      http.StatusOK,
+		},
+
+		{
+			name: "ANY method",
+			globalRules: []GlobalRule{
+				{Permission: "support:*", Methods: []string{MethodAny}},
+			},
+			method:          http.MethodDelete,
+			path:            "/api/v1/category/1",
+			userPermissions: []string{"support:*"},
+			wantStatus:      http.StatusOK,
+		},
+
+		{
+			name:            "Global rules disabled",
+			globalRules:     []GlobalRule{},
+			method:          http.MethodGet,
+			path:            "/api/v1/category/1",
+			userPermissions: []string{"admin:*"},
+			wantStatus:      http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPermissionsChecker(permissionsMatrix, nopLogger{})
+			if tt.globalRules != nil {
+				if err := p.WithGlobalRules(tt.globalRules...); err != nil {
+					t.Fatal(err)
+				}
+			}
+			handler := p.AuthMiddlewareHandler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			r = r.WithContext(context.WithValue(r.Context(), CtxIamPermissions{}, tt.userPermissions))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %v, want %v", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestPermissionsChecker_routeParamPermissions(t *testing.T) {
+	permissionsMatrix := map[string][]string{
+		"POST/api/v1/category/{id}": {"edit:category:{id}"},
+	}
+
+	gorillaRouter := mux.NewRouter()
+	gorillaRouter.HandleFunc("/api/v1/category/{id}", nil).Methods(http.MethodPost)
+	chiRouter := chi.NewRouter()
+	chiRouter.Post("/api/v1/category/{id}", nil)
+
+	checkers := map[string]*PermissionsChecker{
+		"built-in matcher": NewPermissionsChecker(permissionsMatrix, nopLogger{}),
+		"gorilla/mux":      NewPermissionsChecker(permissionsMatrix, nopLogger{}),
+		"chi":              NewPermissionsChecker(permissionsMatrix, nopLogger{}),
+	}
+	checkers["gorilla/mux"].WithGorillaMuxRouter(gorillaRouter)
+	checkers["chi"].WithChiMuxRouter(chiRouter)
+
+	tests := []struct {
+		name            string
+		path            string
+		userPermissions []string
+		wantStatus      int
+	}{
+		{name: "Permission for the requested resource", path: "/api/v1/category/42", userPermissions: []string{"edit:category:42"}, wantStatus: http.StatusOK},
+		{name: "Permission for another resource", path: "/api/v1/category/43", userPermissions: []string{"edit:category:42"}, wantStatus: http.StatusForbidden},
+		{name: "Permission for all resources", path: "/api/v1/category/43", userPermissions: []string{"edit:category:*"}, wantStatus: http.StatusOK},
+		{name: "Parameter can't widen the scope", path: "/api/v1/category/42:1", userPermissions: []string{"edit:category:42"}, wantStatus: http.StatusForbidden},
+	}
+	for checkerName, p := range checkers {
+		handler := p.AuthMiddlewareHandler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+		for _, tt := range tests {
+			t.Run(checkerName+"/"+tt.name, func(t *testing.T) {
+				r := httptest.NewRequest(http.MethodPost, tt.path, nil)
+				r = r.WithContext(context.WithValue(r.Context(), CtxIamPermissions{}, tt.userPermissions))
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, r)
+
+				if w.Code != tt.wantStatus {
+					t.Errorf("status = %v, want %v", w.Code, tt.wantStatus)
+				}
+			})
+		}
+	}
+}
+
+func TestValidatePermissionsMatrix_routeParams(t *testing.T) {
+	err := ValidatePermissionsMatrix(map[string][]string{
+		"POST/api/v1/category/{id}": {"edit:category:{categoryId}"},
+	})
+
+	want := `POST/api/v1/category/{id}: permission "edit:category:{categoryId}": path /api/v1/category/{id} has no parameter {categoryId}`
+	if err == nil || err.Error() != want {
+		t.Errorf("ValidatePermissionsMatrix() error = %v, want %v", err, want)
+	}
+}
+
+func TestPermissionsChecker_WithErrorResponder(t *testing.T) {
+	permissionsMatrix := map[string][]string{
+		"DELETE/api/v1/category/{id}": {"edit:category:{id} & approve", "admin:category"},
+	}
+
+	tests := []struct {
+		name     string
+		details  bool
+		wantBody string
+	}{
+		{
+			name:     "Details are hidden",
+			wantBody: `{"reason":"forbidden","message":"Forbidden","request_id":"req-1"}`,
+		},
+		{
+			name:    "Details",
+			details: true,
+			wantBody: `{"reason":"forbidden","message":"Forbidden","route":"DELETE/api/v1/category/{id}",` +
+				`"required_permissions":["edit:category:{id} \u0026 approve","admin:category"],` +
+				`"missing_permissions":["edit:category:42","admin:category"],"request_id":"req-1"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPermissionsChecker(permissionsMatrix, nopLogger{})
+			p.WithErrorResponder(JSONErrorResponder)
+			p.WithForbiddenDetails(tt.details)
+			handler := p.AuthMiddlewareHandler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+			r := httptest.NewRequest(http.MethodDelete, "/api/v1/category/42", nil)
+			r.Header.Set(RequestIdHeader, "req-1")
+			r = r.WithContext(context.WithValue(r.Context(), CtxIamPermissions{}, []string{"approve", "view:category"}))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != http.StatusForbidden || w.Body.String() != tt.wantBody {
+				t.Errorf("response = %v %s, want %v %s", w.Code, w.Body.String(), http.StatusForbidden, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestPermissionsChecker_forbiddenDetailsWithRequire(t *testing.T) {
+	p := NewPermissionsChecker(map[string][]string{"DELETE/api/v1/category/{id}": {"admin:category", "edit:category"}}, nopLogger{})
+	p.WithErrorResponder(JSONErrorResponder)
+	p.WithForbiddenDetails(true)
+	router := mux.NewRouter()
+	router.Handle("/api/v1/category/{id}", p.Require("approve:category:{id}")(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))).Methods(http.MethodDelete)
+
+	r := httptest.NewRequest(http.MethodDelete, "/api/v1/category/42", nil)
+	r = r.WithContext(context.WithValue(r.Context(), CtxIamPermissions{}, []string{"edit:category"}))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	// Правило матрицы выполнено, не хватает права из Require: списки не смешиваются,
+	// иначе клиент решил бы, что достаточно любого права из общего списка
+	wantBody := `{"reason":"forbidden","message":"Forbidden","route":"DELETE/api/v1/category/{id}",` +
+		`"required_permissions":["admin:category","edit:category"],` +
+		`"route_required_permissions":["approve:category:{id}"],"missing_permissions":["approve:category:42"]}`
+	if w.Code != http.StatusForbidden || w.Body.String() != wantBody {
+		t.Errorf("response = %v %s, want %v %s", w.Code, w.Body.String(), http.StatusForbidden, wantBody)
+	}
+}
+
+func TestPermissionsChecker_serviceErrorResponder(t *testing.T) {
+	checkerResponder := func(w http.ResponseWriter, _ *http.Request, authErr *AuthError) {
+		w.WriteHeader(authErr.Status)
+		_, _ = w.Write([]byte("checker"))
+	}
+
+	tests := []struct {
+		name             string
+		serviceResponder ErrorResponder
+		checkerResponder ErrorResponder
+		wantBody         string
+		wantEchoBody     string
+	}{
+		{name: "No responders", wantBody: "", wantEchoBody: "Forbidden"},
+		{name: "Service responder", serviceResponder: JSONErrorResponder, wantBody: `{"reason":"forbidden","message":"Forbidden"}`, wantEchoBody: `{"reason":"forbidden","message":"Forbidden"}`},
+		{name: "Checker responder wins", serviceResponder: JSONErrorResponder, checkerResponder: checkerResponder, wantBody: "checker", wantEchoBody: "checker"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New("some_service", Config{
+				IamUrl:              newTestIam(t).URL,
+				AccessKeyExtractors: []AccessKeyExtractor{AccessKeyFromQuery{Param: "access_key"}},
+			}, nopLogger{})
+			if tt.serviceResponder != nil {
+				s.WithErrorResponder(tt.serviceResponder)
+			}
+			p := NewPermissionsChecker(map[string][]string{"DELETE/api/v1/category/{id}": {"admin:category"}}, nopLogger{})
+			p.WithErrorResponder(tt.checkerResponder)
+
+			handler := s.AccessKeyOnlyMiddleware(p.AuthMiddlewareHandler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/v1/category/42?access_key=valid", nil))
+			if w.Code != http.StatusForbidden || w.Body.String() != tt.wantBody {
+				t.Errorf("response = %v %s, want %v %s", w.Code, w.Body.String(), http.StatusForbidden, tt.wantBody)
+			}
+
+			e := echo.New()
+			e.DELETE("/api/v1/category/:id", func(c echo.Context) error { return nil }, s.EchoAccessKeyOnlyMiddleware(), p.EchoAuthMiddlewareHandler())
+			w = httptest.NewRecorder()
+			e.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/v1/category/42?access_key=valid", nil))
+			if w.Code != http.StatusForbidden || w.Body.String() != tt.wantEchoBody {
+				t.Errorf("echo response = %v %s, want %v %s", w.Code, w.Body.String(), http.StatusForbidden, tt.wantEchoBody)
+			}
+		})
+	}
+}
+
+func TestPermissionsChecker_EchoWithErrorResponder(t *testing.T) {
+	tests := []struct {
+		name      string
+		responder ErrorResponder
+		wantBody  string
+	}{
+		{name: "Default", wantBody: "Forbidden"},
+		{name: "JSON", responder: JSONErrorResponder, wantBody: `{"reason":"forbidden","message":"Forbidden","request_id":"req-1"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPermissionsChecker(map[string][]string{"DELETE/api/v1/category/{id}": {"admin:category"}}, nopLogger{})
+			p.WithErrorResponder(tt.responder)
+			e := echo.New()
+			e.DELETE("/api/v1/category/:id", func(c echo.Context) error { return nil }, p.EchoAuthMiddlewareHandler())
+
+			r := httptest.NewRequest(http.MethodDelete, "/api/v1/category/42", nil)
+			r.Header.Set(RequestIdHeader, "req-1")
+			r = r.WithContext(context.WithValue(r.Context(), CtxIamPermissions{}, []string{"view:category"}))
+			w := httptest.NewRecorder()
+			e.ServeHTTP(w, r)
+
+			if w.Code != http.StatusForbidden || w.Body.String() != tt.wantBody {
+				t.Errorf("response = %v %s, want %v %s", w.Code, w.Body.String(), http.StatusForbidden, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestNewPermissionsChecker_legacyPermissions(t *testing.T) {
+	p := NewPermissionsChecker(map[string][]string{
+		"GET/api/v1/report":    {"view:report(old)", "admin:report"},
+		"GET/api/v1/item/{id}": {"view:item:{itemId}"},
+	}, nopLogger{})
+
+	tests := []struct {
+		name            string
+		path            string
+		userPermissions []string
+		want            int
+	}{
+		{name: "Unparsable permission as is", path: "/api/v1/report", userPermissions: []string{"view:report(old)"}, want: http.StatusOK},
+		{name: "Other permission of the rule", path: "/api/v1/report", userPermissions: []string{"admin:report"}, want: http.StatusOK},
+		{name: "No permission", path: "/api/v1/report", userPermissions: []string{"view:log"}, want: http.StatusForbidden},
+		{name: "Unknown placeholder as is", path: "/api/v1/item/42", userPermissions: []string{"view:item:{itemId}"}, want: http.StatusOK},
+		{name: "Unknown placeholder is not bound", path: "/api/v1/item/42", userPermissions: []string{"view:item:42"}, want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := p.AuthMiddlewareHandler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r = r.WithContext(context.WithValue(r.Context(), CtxIamPermissions{}, tt.userPermissions))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
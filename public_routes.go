@@ -0,0 +1,92 @@
+package iam_client
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// PublicRoutes список публичных ручек: middleware Service и PermissionsChecker пропускают их
+// без аутентификации и проверки прав, ничего не добавляя в контекст. Один и тот же список
+// передается в Service.WithPublicRoutes и PermissionsChecker.WithPublicRoutes.
+type PublicRoutes struct {
+	keys     []string
+	snapshot *matrixSnapshot
+}
+
+// NewPublicRoutes создает список публичных ручек. keys задаются в формате ключей матрицы доступа
+// и ищутся тем же встроенным матчером: "GET/health", "ANY/metrics", "GET|HEAD/static/**".
+// Так как Service не знает о роутере, пути сравниваются с путем запроса, а не с шаблонами роутера.
+func NewPublicRoutes(keys ...string) (*PublicRoutes, error) {
+	var errs MatrixErrors
+	routes := make(map[string][]string, len(keys))
+	for _, key := range keys {
+		if err := validateMatrixKey(key); err != nil {
+			errs = append(errs, MatrixError{Msg: err.Error()})
+			continue
+		}
+		routes[key] = nil
+	}
+	if err := errs.orNil(); err != nil {
+		return nil, err
+	}
+
+	snapshot, err := newMatrixSnapshot(routes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PublicRoutes{keys: keys, snapshot: snapshot}, nil
+}
+
+// Keys возвращает ключи публичных ручек
+func (pr *PublicRoutes) Keys() []string {
+	if pr == nil {
+		return nil
+	}
+
+	return pr.keys
+}
+
+// Match проверяет, что запрос идет к публичной ручке. Путь должен быть публичным и как есть, и после
+// path.Clean: роутеры, которые не чистят путь (chi, echo), отдали бы "/public/../api/v1/secret"
+// закрытой ручке, хотя он подходит под "/public/**"
+func (pr *PublicRoutes) Match(r *http.Request) bool {
+	if !pr.match(r.Method, r.URL.Path) {
+		return false
+	}
+
+	cleaned := path.Clean(r.URL.Path)
+	if strings.HasSuffix(r.URL.Path, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+
+	return cleaned == r.URL.Path || pr.match(r.Method, cleaned)
+}
+
+func (pr *PublicRoutes) match(method, path string) bool {
+	if pr == nil {
+		return false
+	}
+
+	if route, found := pr.snapshot.byPath[path]; found && route.rule(method, OptionsMatrix) != nil {
+		return true
+	}
+
+	_, _, _, found := pr.snapshot.routes.match(path, func(route *matrixRoute) bool {
+		return route.rule(method, OptionsMatrix) != nil
+	})
+
+	return found
+}
+
+// WithPublicRoutes задает публичные ручки, которые middleware сервиса пропускают без аутентификации
+func (s *Service) WithPublicRoutes(publicRoutes *PublicRoutes) {
+	s.publicRoutes = publicRoutes
+}
+
+// WithPublicRoutes задает публичные ручки, которые middleware проверки прав пропускают как есть.
+// В отчете Validate такие ручки попадают в CoverageReport.PublicRoutes.
+func (p *PermissionsChecker) WithPublicRoutes(publicRoutes *PublicRoutes) {
+	p.publicRoutes = publicRoutes
+}
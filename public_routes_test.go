@@ -0,0 +1,87 @@
+package iam_client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestPublicRoutes(t *testing.T) {
+	publicRoutes, err := NewPublicRoutes("GET|HEAD/health", "ANY/metrics", "GET/static/**")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iam := newTestIam(t)
+	s := New("some_service", Config{IamUrl: iam.URL}, nopLogger{})
+	s.WithPublicRoutes(publicRoutes)
+	p := NewPermissionsChecker(nil, nopLogger{})
+	p.WithPublicRoutes(publicRoutes)
+
+	var gotUserId string
+	handler := s.AuthMiddlewareHandler(p.AuthMiddlewareHandler(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		gotUserId = GetUserId(r.Context())
+	})))
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{name: "Health check", method: http.MethodHead, path: "/health", wantStatus: http.StatusOK},
+		{name: "Any method", method: http.MethodPost, path: "/metrics", wantStatus: http.StatusOK},
+		{name: "Public assets", method: http.MethodGet, path: "/static/js/app.js", wantStatus: http.StatusOK},
+		{name: "Method is not public", method: http.MethodPost, path: "/health", wantStatus: http.StatusUnauthorized},
+		{name: "Private route", method: http.MethodGet, path: "/api/v1/category", wantStatus: http.StatusUnauthorized},
+		{name: "Path traversal from a public prefix", method: http.MethodGet, path: "/static/../api/v1/category", wantStatus: http.StatusUnauthorized},
+		{name: "Encoded path traversal", method: http.MethodGet, path: "/static/%2e%2e/api/v1/category", wantStatus: http.StatusUnauthorized},
+		{name: "Dot segment inside a public prefix", method: http.MethodGet, path: "/static/./js/../css/app.css", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotUserId = "not called"
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			r.Header.Set("Referer", "https://some.app/")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && gotUserId != "" {
+				t.Errorf("user id = %q, want the request untouched", gotUserId)
+			}
+		})
+	}
+}
+
+func TestPublicRoutes_invalid(t *testing.T) {
+	if _, err := NewPublicRoutes("GET/health", "GETT/metrics"); err == nil {
+		t.Error("NewPublicRoutes() with an invalid key returned no error")
+	}
+}
+
+func TestPermissionsChecker_ValidatePublicRoutes(t *testing.T) {
+	publicRoutes, err := NewPublicRoutes("GET/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewPermissionsChecker(nil, nopLogger{})
+	p.WithPublicRoutes(publicRoutes)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/health", func(http.ResponseWriter, *http.Request) {}).Methods(http.MethodGet)
+
+	report, err := p.Validate(router, true)
+	if err != nil {
+		t.Fatalf("Validate() error = %s", err)
+	}
+	want := []Route{{Method: http.MethodGet, Path: "/health"}}
+	if !reflect.DeepEqual(report.PublicRoutes, want) {
+		t.Errorf("Validate() public routes = %v, want %v", report.PublicRoutes, want)
+	}
+}
@@ -0,0 +1,231 @@
+package iam_client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// RolePrefix префикс права-роли: право "role:support_agent" у пользователя раскрывается
+// в права роли support_agent, см. WithRoles
+const RolePrefix = "role:"
+
+// Файл ролей (YAML или JSON) имеет вид:
+//
+//	roles:
+//	  viewer: [view:category, view:item]
+//	  support_agent:
+//	    - view:ticket
+//	    - edit:ticket:comment
+//	    - role:viewer
+//
+// Роль может включать другие роли через "role:name", циклы считаются ошибкой.
+
+// Roles определения ролей сервиса с уже раскрытыми вложенными ролями. После создания не меняется
+type Roles struct {
+	// expanded права каждой роли без вложенных ролей
+	expanded map[string][]string
+}
+
+// NewRoles проверяет определения ролей roles (имя роли без RolePrefix => права и роли "role:name")
+// и раскрывает вложенные роли. Ссылки на неизвестные роли и циклы - ошибка.
+func NewRoles(roles map[string][]string) (*Roles, error) {
+	var errs MatrixErrors
+	for name, permissions := range roles {
+		if err := validateRoleName(name); err != nil {
+			errs = append(errs, MatrixError{Msg: err.Error()})
+		}
+		for _, permission := range permissions {
+			if err := validateRolePermission(roles, permission); err != nil {
+				errs = append(errs, MatrixError{Msg: fmt.Sprintf("role %s: %s", name, err)})
+			}
+		}
+	}
+	if err := errs.orNil(); err != nil {
+		return nil, err
+	}
+
+	expander := roleExpander{roles: roles, expanded: make(map[string][]string, len(roles)), visiting: make(map[string]bool)}
+	for name := range roles {
+		if _, err := expander.expand(name, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Roles{expanded: expander.expanded}, nil
+}
+
+// LoadRoles читает определения ролей из YAML или JSON файла
+func LoadRoles(path string) (*Roles, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read roles")
+	}
+
+	roles, err := ParseRoles(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "roles %s", path)
+	}
+
+	return roles, nil
+}
+
+// ParseRoles разбирает определения ролей в формате YAML или JSON, см. NewRoles
+func ParseRoles(data []byte) (*Roles, error) {
+	var doc struct {
+		Roles map[string][]string `yaml:"roles"`
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, errors.Wrap(err, "parse roles")
+	}
+
+	return NewRoles(doc.Roles)
+}
+
+// Permissions возвращает все права роли name с учетом вложенных ролей
+func (roles *Roles) Permissions(name string) ([]string, bool) {
+	if roles == nil {
+		return nil, false
+	}
+
+	permissions, found := roles.expanded[name]
+	return permissions, found
+}
+
+// Expand заменяет в правах пользователя известные роли "role:name" их правами. Неизвестные роли
+// остаются как есть. Если раскрывать нечего, возвращает тот же срез без выделения памяти.
+func (roles *Roles) Expand(permissions []string) []string {
+	if roles == nil || !roles.hasRole(permissions) {
+		return permissions
+	}
+
+	result := make([]string, 0, len(permissions))
+	for _, permission := range permissions {
+		if rolePermissions, found := roles.role(permission); found {
+			for _, rolePermission := range rolePermissions {
+				if !InArray(result, rolePermission) {
+					result = append(result, rolePermission)
+				}
+			}
+			continue
+		}
+		if !InArray(result, permission) {
+			result = append(result, permission)
+		}
+	}
+
+	return result
+}
+
+func (roles *Roles) hasRole(permissions []string) bool {
+	for _, permission := range permissions {
+		if _, found := roles.role(permission); found {
+			return true
+		}
+	}
+
+	return false
+}
+
+// role возвращает права роли, если permission - известная роль "role:name"
+func (roles *Roles) role(permission string) ([]string, bool) {
+	name, isRole := strings.CutPrefix(permission, RolePrefix)
+	if !isRole {
+		return nil, false
+	}
+
+	permissions, found := roles.expanded[name]
+	return permissions, found
+}
+
+// WithRoles задает определения ролей: перед проверкой прав роли "role:name" в правах пользователя
+// раскрываются в права роли. Middleware передают дальше запрос с уже раскрытыми правами,
+// поэтому GetPermissions, HasPermission и т.п. в ручках видят права ролей.
+func (p *PermissionsChecker) WithRoles(roles *Roles) {
+	p.roles = roles
+}
+
+// expandRoles возвращает запрос с раскрытыми ролями в правах пользователя или r, если раскрывать нечего
+func (p *PermissionsChecker) expandRoles(r *http.Request) *http.Request {
+	permissions := GetPermissions(r.Context())
+	if p.roles == nil || !p.roles.hasRole(permissions) {
+		return r
+	}
+
+	return r.WithContext(context.WithValue(r.Context(), CtxIamPermissions{}, p.roles.Expand(permissions)))
+}
+
+// roleExpander раскрывает вложенные роли с поиском циклов
+type roleExpander struct {
+	roles    map[string][]string
+	expanded map[string][]string
+	visiting map[string]bool
+}
+
+func (e *roleExpander) expand(name string, path []string) ([]string, error) {
+	if permissions, found := e.expanded[name]; found {
+		return permissions, nil
+	}
+	path = append(path, name)
+	if e.visiting[name] {
+		return nil, errors.Errorf("role cycle %s", strings.Join(path, " -> "))
+	}
+	e.visiting[name] = true
+	defer delete(e.visiting, name)
+
+	var permissions []string
+	for _, permission := range e.roles[name] {
+		nested, isRole := strings.CutPrefix(permission, RolePrefix)
+		if !isRole {
+			if !InArray(permissions, permission) {
+				permissions = append(permissions, permission)
+			}
+			continue
+		}
+
+		nestedPermissions, err := e.expand(nested, path)
+		if err != nil {
+			return nil, err
+		}
+		for _, nestedPermission := range nestedPermissions {
+			if !InArray(permissions, nestedPermission) {
+				permissions = append(permissions, nestedPermission)
+			}
+		}
+	}
+	e.expanded[name] = permissions
+
+	return permissions, nil
+}
+
+func validateRoleName(name string) error {
+	if strings.Contains(name, ":") || validateMatrixPermission(name) != nil {
+		return errors.Errorf("invalid role name %q", name)
+	}
+
+	return nil
+}
+
+// validateRolePermission проверяет право роли: право пользователя (без плейсхолдеров) или известная роль
+func validateRolePermission(roles map[string][]string, permission string) error {
+	if nested, isRole := strings.CutPrefix(permission, RolePrefix); isRole {
+		if _, found := roles[nested]; !found {
+			return errors.Errorf("unknown role %q", nested)
+		}
+		return nil
+	}
+
+	if strings.Contains(permission, "{") || validateMatrixPermission(permission) != nil {
+		return errors.Errorf("invalid permission %q, expected \"base[:scope...]\"", permission)
+	}
+
+	return nil
+}
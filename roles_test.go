@@ -0,0 +1,118 @@
+package iam_client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+const testRoles = `
+roles:
+  viewer: [view:category, view:item]
+  support_agent:
+    - view:ticket
+    - edit:ticket:comment
+    - role:viewer
+  lead:
+    - role:support_agent
+    - role:viewer
+    - approve
+`
+
+func TestRoles_Expand(t *testing.T) {
+	roles, err := ParseRoles([]byte(testRoles))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		permissions []string
+		want        []string
+	}{
+		{name: "No roles", permissions: []string{"view:log"}, want: []string{"view:log"}},
+		{name: "Role", permissions: []string{"role:viewer", "view:log"}, want: []string{"view:category", "view:item", "view:log"}},
+		{
+			name:        "Nested roles",
+			permissions: []string{"role:lead"},
+			want:        []string{"view:ticket", "edit:ticket:comment", "view:category", "view:item", "approve"},
+		},
+		{name: "Unknown role", permissions: []string{"role:unknown", "role:viewer"}, want: []string{"role:unknown", "view:category", "view:item"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := roles.Expand(tt.permissions); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expand() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRoles_invalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		roles map[string][]string
+	}{
+		{name: "Cycle", roles: map[string][]string{"a": {"role:b"}, "b": {"view", "role:c"}, "c": {"role:a"}}},
+		{name: "Self reference", roles: map[string][]string{"a": {"role:a"}}},
+		{name: "Unknown nested role", roles: map[string][]string{"a": {"role:b"}}},
+		{name: "Invalid permission", roles: map[string][]string{"a": {"edit:category:{id}"}}},
+		{name: "Invalid role name", roles: map[string][]string{"role:a": {"view"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewRoles(tt.roles); err == nil {
+				t.Error("NewRoles() returned no error")
+			}
+		})
+	}
+}
+
+func TestPermissionsChecker_WithRoles(t *testing.T) {
+	roles, err := ParseRoles([]byte(testRoles))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewPermissionsChecker(map[string][]string{
+		"GET/api/v1/ticket/{id}":  {"view:ticket"},
+		"POST/api/v1/ticket/{id}": {"edit:ticket & approve"},
+	}, nopLogger{})
+	p.WithRoles(roles)
+
+	var gotCanSeeItems bool
+	handler := p.AuthMiddlewareHandler(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		gotCanSeeItems = HasPermission(r.Context(), "view:item")
+	}))
+
+	tests := []struct {
+		name       string
+		method     string
+		wantStatus int
+	}{
+		{name: "Permission of a nested role", method: http.MethodGet, wantStatus: http.StatusOK},
+		{name: "Role lacks a permission", method: http.MethodPost, wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotCanSeeItems = false
+			r := httptest.NewRequest(tt.method, "/api/v1/ticket/1", nil)
+			r = r.WithContext(context.WithValue(r.Context(), CtxIamPermissions{}, []string{"role:support_agent"}))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && !gotCanSeeItems {
+				t.Error("handler does not see permissions of the role")
+			}
+		})
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/ticket/1", nil)
+	if decision := p.Explain(r, []string{"role:lead"}); !decision.Allowed {
+		t.Errorf("Explain() = %s, want allow", decision)
+	}
+}
@@ -0,0 +1,94 @@
+package iam_client
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// IamClient возвращает клиент IAM сервиса, например, для WatchIamRoutePolicy
+func (s *Service) IamClient() *IamClient {
+	return s.iamClient
+}
+
+// WatchIamRoutePolicy загружает матрицу доступа сервиса из IAM (см. IamClient.GetRoutePolicy) и затем
+// раз в interval проверяет, не изменилась ли она, передавая ETag последней полученной версии.
+// Пока IAM недоступен или отдает невалидную матрицу, в силе остается последняя хорошая версия.
+// Если при старте IAM недоступен, матрица читается из fallbackPath (если он задан), а при ошибке
+// и там - остается матрица, переданная в NewPermissionsChecker.
+// Первая загрузка выполняется синхронно: ошибка возвращается, если матрицу не удалось получить ни из IAM,
+// ни из fallbackPath, но опрос IAM запускается в любом случае. Горутина работает до отмены ctx.
+// Неположительный interval - ошибка, в этом случае ничего не загружается и опрос не запускается.
+func (p *PermissionsChecker) WatchIamRoutePolicy(ctx context.Context, client *IamClient, interval time.Duration, fallbackPath string) error {
+	if interval <= 0 {
+		return errors.Errorf("route policy poll interval must be positive, got %s", interval)
+	}
+
+	etag, err := p.fetchRoutePolicy(client, "")
+	var lastErr string
+	if err != nil {
+		lastErr = err.Error()
+		p.log.Errorf("gT4nRw8ZkQ1bVxa route policy from IAM is unavailable: %s", err)
+		if fallbackPath != "" {
+			permissionsMatrix, fileErr := LoadPermissionsMatrix(fallbackPath)
+			if fileErr == nil {
+				fileErr = p.ReplacePermissionsMatrix(permissionsMatrix)
+			}
+			if fileErr == nil {
+				p.log.Infof("permissions matrix loaded from the fallback %s, %d rules", fallbackPath, len(permissionsMatrix))
+				err = nil
+			} else {
+				err = errors.Wrapf(err, "fallback: %s", fileErr)
+			}
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			newEtag, err := p.fetchRoutePolicy(client, etag)
+			if err != nil {
+				// Ошибку запроса IamClient уже записал, здесь пишем только смену ошибки: что матрица не обновилась
+				if err.Error() != lastErr {
+					p.log.Errorf("Yc2mHs7PqLw0NdE route policy from IAM is unavailable, keeping the previous one: %s", err)
+					lastErr = err.Error()
+				}
+				continue
+			}
+			if lastErr != "" {
+				p.log.Infof("route policy from IAM is available again")
+				lastErr = ""
+			}
+			etag = newEtag
+		}
+	}()
+
+	return err
+}
+
+// fetchRoutePolicy загружает матрицу из IAM и заменяет ей текущую, возвращает ETag текущей матрицы
+func (p *PermissionsChecker) fetchRoutePolicy(client *IamClient, etag string) (string, error) {
+	resp, err := client.GetRoutePolicy(etag)
+	if err != nil {
+		return etag, err
+	}
+	if resp.NotModified {
+		return resp.ETag, nil
+	}
+
+	if err := p.ReplacePermissionsMatrix(resp.PermissionsMatrix); err != nil {
+		return etag, errors.Wrap(err, "route policy from IAM")
+	}
+	p.log.Infof("permissions matrix reloaded from IAM, version %s, %d rules", resp.ETag, len(resp.PermissionsMatrix))
+
+	return resp.ETag, nil
+}
@@ -0,0 +1,147 @@
+package iam_client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testRoutePolicyIam IAM, который отдает матрицу доступа сервиса с ETag
+type testRoutePolicyIam struct {
+	mu       sync.Mutex
+	policy   string
+	etag     string
+	status   int
+	requests []string
+}
+
+func (iam *testRoutePolicyIam) set(status int, etag, policy string) {
+	iam.mu.Lock()
+	defer iam.mu.Unlock()
+	iam.status, iam.etag, iam.policy = status, etag, policy
+}
+
+func (iam *testRoutePolicyIam) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	iam.mu.Lock()
+	defer iam.mu.Unlock()
+	iam.requests = append(iam.requests, r.URL.Query().Get("service_id")+" "+r.Header.Get("If-None-Match"))
+
+	switch {
+	case iam.status != http.StatusOK:
+		w.WriteHeader(iam.status)
+	case r.Header.Get("If-None-Match") == iam.etag:
+		w.WriteHeader(http.StatusNotModified)
+	default:
+		w.Header().Set("ETag", iam.etag)
+		_, _ = w.Write([]byte(iam.policy))
+	}
+}
+
+func TestIamClient_GetRoutePolicy(t *testing.T) {
+	iam := &testRoutePolicyIam{}
+	iam.set(http.StatusOK, `"v1"`, `{"rules": [{"method": "GET", "path": "/api/v1/admin/actionLog", "permissions": ["view:log"]}]}`)
+	server := httptest.NewServer(iam)
+	defer server.Close()
+	client := NewIamClient("some_service", server.URL, nopLogger{}, http.DefaultClient)
+
+	resp, err := client.GetRoutePolicy("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{"GET/api/v1/admin/actionLog": {"view:log"}}
+	if resp.ETag != `"v1"` || resp.NotModified || !reflect.DeepEqual(resp.PermissionsMatrix, want) {
+		t.Errorf("GetRoutePolicy() = %+v, want ETag \"v1\" and %v", resp, want)
+	}
+
+	resp, err = client.GetRoutePolicy(`"v1"`)
+	if err != nil || !resp.NotModified || resp.ETag != `"v1"` {
+		t.Errorf("GetRoutePolicy() with the current ETag = %+v, %v, want not modified", resp, err)
+	}
+
+	wantRequests := []string{"some_service ", `some_service "v1"`}
+	if !reflect.DeepEqual(iam.requests, wantRequests) {
+		t.Errorf("requests = %q, want %q", iam.requests, wantRequests)
+	}
+
+	iam.set(http.StatusOK, `"v2"`, `{"rules": [{"method": "GETT", "path": "/api/v1/admin/actionLog", "permissions": ["view:log"]}]}`)
+	if _, err := client.GetRoutePolicy(`"v1"`); err == nil {
+		t.Error("GetRoutePolicy() accepted an invalid matrix")
+	}
+}
+
+func TestPermissionsChecker_WatchIamRoutePolicy(t *testing.T) {
+	iam := &testRoutePolicyIam{}
+	iam.set(http.StatusServiceUnavailable, "", "")
+	server := httptest.NewServer(iam)
+	defer server.Close()
+	client := NewIamClient("some_service", server.URL, nopLogger{}, http.DefaultClient)
+
+	fallbackPath := filepath.Join(t.TempDir(), "permissions.yaml")
+	err := os.WriteFile(fallbackPath, []byte("rules:\n  - {method: GET, path: /api/v1/admin/actionLog, permissions: [admin:log]}\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewPermissionsChecker(nil, nopLogger{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := p.WatchIamRoutePolicy(ctx, client, 5*time.Millisecond, fallbackPath); err != nil {
+		t.Fatalf("WatchIamRoutePolicy() with a fallback error = %s", err)
+	}
+
+	r := &http.Request{Method: http.MethodGet, URL: &url.URL{Path: "/api/v1/admin/actionLog"}}
+	if got := p.getAllowedPermissions(r); !reflect.DeepEqual(got, []string{"admin:log"}) {
+		t.Fatalf("getAllowedPermissions() = %v, want the fallback matrix", got)
+	}
+
+	waitFor := func(want []string) {
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			if reflect.DeepEqual(p.getAllowedPermissions(r), want) {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatalf("getAllowedPermissions() = %v, want %v", p.getAllowedPermissions(r), want)
+	}
+
+	iam.set(http.StatusOK, `"v1"`, `{"rules": [{"method": "GET", "path": "/api/v1/admin/actionLog", "permissions": ["view:log"]}]}`)
+	waitFor([]string{"view:log"})
+
+	// Недоступный IAM не должен сломать последнюю хорошую матрицу
+	iam.set(http.StatusInternalServerError, "", "")
+	time.Sleep(50 * time.Millisecond)
+	waitFor([]string{"view:log"})
+}
+
+func TestPermissionsChecker_WatchIamRoutePolicy_unavailable(t *testing.T) {
+	client := NewIamClient("some_service", "http://127.0.0.1:1", nopLogger{}, http.DefaultClient)
+	p := NewPermissionsChecker(map[string][]string{"GET/api/v1/admin/actionLog": {"view:log"}}, nopLogger{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := p.WatchIamRoutePolicy(ctx, client, time.Hour, filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("WatchIamRoutePolicy() without IAM and the fallback returned no error")
+	}
+	r := &http.Request{Method: http.MethodGet, URL: &url.URL{Path: "/api/v1/admin/actionLog"}}
+	if got := p.getAllowedPermissions(r); !reflect.DeepEqual(got, []string{"view:log"}) {
+		t.Errorf("getAllowedPermissions() = %v, want the initial matrix", got)
+	}
+}
+
+func TestPermissionsChecker_WatchIamRoutePolicy_interval(t *testing.T) {
+	p := NewPermissionsChecker(nil, nopLogger{})
+	client := NewIamClient("some_service", "http://127.0.0.1:0", nopLogger{}, http.DefaultClient)
+	for _, interval := range []time.Duration{0, -time.Second} {
+		if err := p.WatchIamRoutePolicy(context.Background(), client, interval, ""); err == nil {
+			t.Errorf("WatchIamRoutePolicy() with interval %s returned no error", interval)
+		}
+	}
+}
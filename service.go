@@ -2,7 +2,6 @@ package iam_client
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -29,10 +28,18 @@ func New(serviceId string, cfg Config, logger Logger) *Service {
 
 // NewWithHTTPClient создает объект сервиса с заранее созданным HTTP клиентом
 func NewWithHTTPClient(serviceId string, cfg Config, logger Logger, httpClient *http.Client) *Service {
+	accessKeyExtractors := cfg.AccessKeyExtractors
+	if len(accessKeyExtractors) == 0 {
+		accessKeyExtractors = DefaultAccessKeyExtractors()
+	}
+
 	return &Service{
-		log:       logger,
-		iamClient: NewIamClient(serviceId, cfg.IamUrl, logger, httpClient),
-		serviceId: serviceId,
+		log:                 logger,
+		iamClient:           NewIamClient(serviceId, cfg.IamUrl, logger, httpClient),
+		serviceId:           serviceId,
+		accessKeyExtractors: accessKeyExtractors,
+		errorResponder:      DefaultErrorResponder,
+		echoContextKeys:     DefaultEchoContextKeys,
 	}
 }
 
@@ -40,6 +47,18 @@ type Service struct {
 	log       Logger
 	iamClient *IamClient
 	serviceId string
+	// accessKeyExtractors источники ключа доступа в порядке приоритета
+	accessKeyExtractors []AccessKeyExtractor
+	// errorResponder отрисовывает ошибки аутентификации, см. WithErrorResponder
+	errorResponder ErrorResponder
+	// errorResponderSet errorResponder задан через WithErrorResponder и передается PermissionsChecker в контексте
+	errorResponderSet bool
+	// echoHTTPErrors echo-middleware возвращают *echo.HTTPError вместо записи ответа, см. WithEchoHTTPErrors
+	echoHTTPErrors bool
+	// echoContextKeys ключи, под которыми echo-middleware кладут данные пользователя в echo.Context
+	echoContextKeys EchoContextKeys
+	// publicRoutes ручки, которые middleware пропускают без аутентификации, см. WithPublicRoutes
+	publicRoutes *PublicRoutes
 }
 
 type link401 struct {
@@ -110,13 +129,6 @@ func (s *Service) getBackURL(r *http.Request) (string, error) {
 	return requestURL, nil
 }
 
-func (s *Service) returnRedirectJSON(w http.ResponseWriter, redirectURL string) {
-	data, _ := json.Marshal(link401{RedirectURL: redirectURL})
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	w.WriteHeader(http.StatusUnauthorized)
-	_, _ = w.Write(data)
-}
-
 // getRequestURL возвращает URL текущего запроса АПИ. На него надо будет вернуть
 // пользователя после успешной аутентификации в IAM
 func (s *Service) getRequestURL(r *http.Request) string {
@@ -128,6 +140,11 @@ func (s *Service) getRequestURL(r *http.Request) string {
 		uri = r.URL.RequestURI()
 	}
 
+	// Ключ доступа из query не должен утечь в IAM и в логи вместе с backURL
+	if u, err := url.ParseRequestURI(uri); err == nil {
+		uri = s.stripAccessKeys(u).RequestURI()
+	}
+
 	return "https://" + strings.Trim(r.Host, "/") + uri
 }
 